@@ -2,7 +2,7 @@ package api
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -13,21 +13,33 @@ import (
 	"github.com/jackc/pgx/v5"
 
 	hhconst "github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/dbtx"
 	"github.com/MicahParks/httphandle/middleware/ctxkey"
+	"github.com/MicahParks/httphandle/middleware/membudget"
 )
 
 type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code int `json:"code"`
+	// ErrorCode is a stable, machine-readable identifier of the error, such as CodeValidationFailed.
+	ErrorCode string `json:"errorCode"`
+	Message   string `json:"message"`
 }
 
+// NewAPIError creates an error response with the default error code of the HTTP status code.
 func NewAPIError(ctx context.Context, code int, message string) Response {
+	return NewAPIErrorCode(ctx, code, StatusErrorCode(code), message)
+}
+
+// NewAPIErrorCode creates an error response with an error code, such as CodeInvalidJSON.
+func NewAPIErrorCode(ctx context.Context, code int, errorCode, message string) Response {
 	apiError := Error{
-		Code:    code,
-		Message: message,
+		Code:      code,
+		ErrorCode: errorCode,
+		Message:   message,
 	}
+	reqUUID, _ := ctxkey.ReqUUIDFrom(ctx)
 	meta := Metadata{
-		RequestUUID: ctx.Value(ctxkey.ReqUUID).(uuid.UUID),
+		RequestUUID: reqUUID,
 	}
 	return Response{
 		Data:     apiError,
@@ -54,11 +66,17 @@ func AuthorizeError(ctx context.Context, code int, message string, w http.Respon
 	return false, nil
 }
 
+// CommitTx commits the request's transaction, which was added by middleware.CreateAddTx or middleware.CreateAddDBTx,
+// and responds with an empty body.
 func CommitTx(ctx context.Context, responseCode int) (code int, body []byte, err error) {
-	tx := ctx.Value(ctxkey.Tx).(pgx.Tx)
+	l := ctxkey.LoggerFrom(ctx)
+	tx, ok := dbtx.FromContext(ctx)
+	if !ok {
+		l.ErrorContext(ctx, "Failed to find transaction in request context.")
+		return ErrorResponse(ctx, http.StatusInternalServerError, hhconst.RespInternalServerError)
+	}
 	err = tx.Commit(ctx)
 	if err != nil {
-		l := ctx.Value(ctxkey.Logger).(*slog.Logger)
 		l.ErrorContext(ctx, "Failed to commit transaction.",
 			hhconst.LogErr, err,
 		)
@@ -67,30 +85,95 @@ func CommitTx(ctx context.Context, responseCode int) (code int, body []byte, err
 	return RespondJSON(ctx, responseCode, nil)
 }
 
+// BeginSavepoint creates a savepoint in the request's transaction, which was added by middleware.CreateAddTx,
+// middleware.CreateAddTxOptions, or middleware.CreateAddDBTx with dbtx.PgxBeginner. Commit the returned transaction to
+// release the savepoint or roll it back to undo only the work done since the savepoint, leaving the request's
+// transaction usable.
+func BeginSavepoint(ctx context.Context) (pgx.Tx, error) {
+	tx, ok := ctxkey.TxFrom(ctx)
+	if !ok {
+		return nil, errors.New("request context has no pgx transaction")
+	}
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	return sp, nil
+}
+
+// WithSavepoint runs f in a savepoint of the request's transaction. The savepoint is released if f returns nil and
+// rolled back otherwise, so optional work like a best-effort audit insert can fail without aborting the request's
+// transaction. The context passed to f holds the savepoint as its transaction under both ctxkey.Tx and ctxkey.DBTx, so
+// savepoints can be nested. The error of f is returned.
+func WithSavepoint(ctx context.Context, f func(ctx context.Context, tx pgx.Tx) error) error {
+	sp, err := BeginSavepoint(ctx)
+	if err != nil {
+		return err
+	}
+	spCtx := context.WithValue(ctx, ctxkey.Tx, sp)
+	spCtx = context.WithValue(spCtx, ctxkey.DBTx, dbtx.Pgx(sp))
+	err = f(spCtx, sp)
+	if err != nil {
+		rollbackErr := sp.Rollback(ctx)
+		if rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to rollback to savepoint: %w", rollbackErr))
+		}
+		return err
+	}
+	err = sp.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
+
+// ErrorResponse creates an error response with the default error code of the HTTP status code.
 func ErrorResponse(ctx context.Context, code int, message string) (int, []byte, error) {
-	data, err := errorBody(ctx, code, message)
+	return ErrorResponseCode(ctx, code, StatusErrorCode(code), message)
+}
+
+// ErrorResponseCode creates an error response with an error code, such as CodeInvalidJSON.
+func ErrorResponseCode(ctx context.Context, code int, errorCode, message string) (int, []byte, error) {
+	data, err := MarshalResponse(ctx, NewAPIErrorCode(ctx, code, errorCode, message))
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, fmt.Errorf("failed to JSON marshal error response: %w", err)
 	}
 	return code, data, nil
 }
 
 func ExtractJSON[ReqData jt.Defaulter[ReqData]](r *http.Request) (reqData ReqData, l *slog.Logger, ctx context.Context, code int, body []byte, err error) {
 	ctx = r.Context()
-	l = ctx.Value(ctxkey.Logger).(*slog.Logger)
+	l = ctxkey.LoggerFrom(ctx)
 
 	//goland:noinspection GoUnhandledErrorResult
 	defer r.Body.Close()
 
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
+		if errors.Is(err, membudget.ErrExceeded) {
+			code, body, _ = ErrorResponse(ctx, http.StatusRequestEntityTooLarge, "Request body exceeds memory budget.")
+			return reqData, l, ctx, code, body, err
+		}
+		// The server closes the connection after the response, because the rest of the body is unread.
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			code, body, _ = ErrorResponse(ctx, http.StatusRequestEntityTooLarge, TooLargeMessage(maxBytesErr.Limit))
+			return reqData, l, ctx, code, body, err
+		}
 		code, body, _ = ErrorResponse(ctx, http.StatusBadRequest, "Failed to read request body.")
 		return reqData, l, ctx, code, body, err
 	}
 
-	err = json.Unmarshal(b, &reqData)
+	// Decoding roughly doubles the memory held for the body.
+	err = membudget.Charge(ctx, int64(len(b)))
+	if err != nil {
+		code, body, _ = ErrorResponse(ctx, http.StatusRequestEntityTooLarge, "Request body exceeds memory budget.")
+		return reqData, l, ctx, code, body, err
+	}
+
+	err = unmarshalJSON(ctx, b, &reqData)
 	if err != nil {
-		code, body, _ = ErrorResponse(ctx, http.StatusUnsupportedMediaType, "Failed to JSON parse request body.")
+		code, body, _ = ErrorResponseCode(ctx, http.StatusUnsupportedMediaType, CodeInvalidJSON, "Failed to JSON parse request body.")
 		return reqData, l, ctx, code, body, err
 	}
 
@@ -103,24 +186,52 @@ func ExtractJSON[ReqData jt.Defaulter[ReqData]](r *http.Request) (reqData ReqDat
 	return reqData, l, ctx, http.StatusOK, nil, nil
 }
 
+// TooLargeMessage is the message of a 413 response for a request body larger than the limit in bytes.
+func TooLargeMessage(limit int64) string {
+	return fmt.Sprintf("Request body exceeds the limit of %d bytes.", limit)
+}
+
+// RespondJSON marshals data in the response envelope for an API handler's Respond method. Handlers that write their own
+// response can use WriteJSON to encode into a pooled buffer instead.
 func RespondJSON(ctx context.Context, code int, data any) (int, []byte, error) {
+	reqUUID, _ := ctxkey.ReqUUIDFrom(ctx)
 	meta := Metadata{
-		RequestUUID: ctx.Value(ctxkey.ReqUUID).(uuid.UUID),
+		RequestUUID: reqUUID,
 	}
 	r := Response{
 		Data:     data,
 		Metadata: meta,
 	}
-	r.Metadata = meta
-	b, err := json.Marshal(r)
+	b, err := MarshalResponse(ctx, r)
 	if err != nil {
 		return 0, nil, fmt.Errorf("failed to JSON marshal response: %w", err)
 	}
 	return code, b, nil
 }
 
+// MarshalResponse JSON marshals the response, or only its data if the context is marked by WithoutEnvelope.
+func MarshalResponse(ctx context.Context, r Response) ([]byte, error) {
+	if !Enveloped(ctx) {
+		return marshalJSON(ctx, r.Data)
+	}
+	return marshalJSON(ctx, r)
+}
+
+// WithoutEnvelope marks the context, so responses created with it are sent without the data and metadata envelope.
+// Attach does this for API handlers that opt out of the envelope and sets the request UUID in the
+// constant.HeaderRequestUUID header instead.
+func WithoutEnvelope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxkey.NoEnvelope, true)
+}
+
+// Enveloped reports whether responses created with the context use the data and metadata envelope.
+func Enveloped(ctx context.Context) bool {
+	noEnvelope, _ := ctx.Value(ctxkey.NoEnvelope).(bool)
+	return !noEnvelope
+}
+
 func errorBody(ctx context.Context, code int, message string) ([]byte, error) {
-	data, err := json.Marshal(NewAPIError(ctx, code, message))
+	data, err := MarshalResponse(ctx, NewAPIError(ctx, code, message))
 	if err != nil {
 		return nil, fmt.Errorf("failed to JSON marshal error response: %w", err)
 	}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+
+	hhconst "github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+var (
+	// ErrChecksum is returned by ChunkReader when the data chunks don't match the trailer.
+	ErrChecksum = errors.New("chunked response checksum mismatch")
+	// ErrTruncated is returned by ChunkReader when the stream ends without a trailer.
+	ErrTruncated = errors.New("chunked response ended without a trailer")
+)
+
+// Segment is one line of a chunked envelope. Exactly one field is set. The first segment carries Metadata, the data
+// segments carry Data, and the last segment carries a Trailer, or an Error if the server failed part way through.
+type Segment struct {
+	Data     json.RawMessage `json:"data,omitempty"`
+	Error    *Error          `json:"error,omitempty"`
+	Metadata *Metadata       `json:"metadata,omitempty"`
+	Trailer  *Trailer        `json:"trailer,omitempty"`
+}
+
+// Trailer is the last segment of a successful chunked envelope.
+type Trailer struct {
+	// Checksum is the hex encoded SHA-256 of the data segments' raw JSON, in order.
+	Checksum string `json:"checksum"`
+	Chunks   int    `json:"chunks"`
+}
+
+// ChunkWriter streams a large response as newline delimited envelope segments, so neither side has to hold the whole
+// dataset in memory. Use it from a General handler, because API handlers return their body all at once.
+type ChunkWriter struct {
+	chunks int
+	done   bool
+	enc    *json.Encoder
+	hash   hash.Hash
+	rc     *http.ResponseController
+}
+
+// NewChunkWriter writes the response header and the metadata segment.
+func NewChunkWriter(ctx context.Context, code int, w http.ResponseWriter) (*ChunkWriter, error) {
+	w.Header().Set(hhconst.HeaderContentType, hhconst.ContentTypeNDJSON)
+	w.WriteHeader(code)
+	c := &ChunkWriter{
+		enc:  json.NewEncoder(w),
+		hash: sha256.New(),
+		rc:   http.NewResponseController(w),
+	}
+	reqUUID, _ := ctxkey.ReqUUIDFrom(ctx)
+	meta := Metadata{
+		RequestUUID: reqUUID,
+	}
+	err := c.write(Segment{Metadata: &meta})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write writes a data segment and flushes it to the client.
+func (c *ChunkWriter) Write(data any) error {
+	if c.done {
+		return errors.New("chunked response is already closed")
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to JSON marshal chunk: %w", err)
+	}
+	c.hash.Write(b)
+	c.chunks++
+	return c.write(Segment{Data: b})
+}
+
+// Close writes the trailer segment. It does nothing if the response is already closed.
+func (c *ChunkWriter) Close() error {
+	if c.done {
+		return nil
+	}
+	c.done = true
+	return c.write(Segment{Trailer: &Trailer{
+		Checksum: hex.EncodeToString(c.hash.Sum(nil)),
+		Chunks:   c.chunks,
+	}})
+}
+
+// Fail ends the response with an error segment instead of a trailer. The status code has already been sent, so code is
+// only informational.
+func (c *ChunkWriter) Fail(code int, message string) error {
+	if c.done {
+		return nil
+	}
+	c.done = true
+	return c.write(Segment{Error: &Error{
+		Code:      code,
+		ErrorCode: StatusErrorCode(code),
+		Message:   message,
+	}})
+}
+
+func (c *ChunkWriter) write(s Segment) error {
+	err := c.enc.Encode(s)
+	if err != nil {
+		return fmt.Errorf("failed to write chunked response segment: %w", err)
+	}
+	err = c.rc.Flush()
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return fmt.Errorf("failed to flush chunked response segment: %w", err)
+	}
+	return nil
+}
+
+// ChunkReader consumes a response written by ChunkWriter one segment at a time.
+type ChunkReader struct {
+	chunks   int
+	hash     hash.Hash
+	metadata Metadata
+	scanner  *bufio.Scanner
+	trailer  *Trailer
+}
+
+// NewChunkReader reads the metadata segment from r. maxChunk is the largest segment in bytes the reader accepts.
+func NewChunkReader(r io.Reader, maxChunk int) (*ChunkReader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(maxChunk, 64*1024)), maxChunk)
+	c := &ChunkReader{
+		hash:    sha256.New(),
+		scanner: scanner,
+	}
+	s, err := c.segment()
+	if err != nil {
+		return nil, err
+	}
+	if s.Error != nil {
+		return nil, fmt.Errorf("chunked response failed with code %d: %s", s.Error.Code, s.Error.Message)
+	}
+	if s.Metadata == nil {
+		return nil, errors.New("chunked response did not start with metadata")
+	}
+	c.metadata = *s.Metadata
+	return c, nil
+}
+
+// Metadata returns the metadata segment.
+func (c *ChunkReader) Metadata() Metadata {
+	return c.metadata
+}
+
+// Next unmarshals the next data segment into v. It returns false when the trailer has been read and verified.
+func (c *ChunkReader) Next(v any) (bool, error) {
+	if c.trailer != nil {
+		return false, nil
+	}
+	s, err := c.segment()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case s.Error != nil:
+		return false, fmt.Errorf("chunked response failed with code %d: %s", s.Error.Code, s.Error.Message)
+	case s.Trailer != nil:
+		c.trailer = s.Trailer
+		if s.Trailer.Chunks != c.chunks || s.Trailer.Checksum != hex.EncodeToString(c.hash.Sum(nil)) {
+			return false, ErrChecksum
+		}
+		return false, nil
+	case s.Data == nil:
+		return false, errors.New("unexpected chunked response segment")
+	}
+	c.hash.Write(s.Data)
+	c.chunks++
+	err = json.Unmarshal(s.Data, v)
+	if err != nil {
+		return false, fmt.Errorf("failed to JSON unmarshal chunk: %w", err)
+	}
+	return true, nil
+}
+
+func (c *ChunkReader) segment() (Segment, error) {
+	var s Segment
+	if !c.scanner.Scan() {
+		err := c.scanner.Err()
+		if err != nil {
+			return s, fmt.Errorf("failed to read chunked response segment: %w", err)
+		}
+		return s, ErrTruncated
+	}
+	err := json.Unmarshal(c.scanner.Bytes(), &s)
+	if err != nil {
+		return s, fmt.Errorf("failed to JSON unmarshal chunked response segment: %w", err)
+	}
+	return s, nil
+}
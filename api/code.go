@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+)
+
+// Error codes are stable, machine-readable identifiers of errors, so clients can branch on them instead of parsing
+// messages. Applications may use their own codes alongside these.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeConflict             = "conflict"
+	CodeForbidden            = "forbidden"
+	CodeInternal             = "internal"
+	CodeInvalidJSON          = "invalid_json"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeNotFound             = "not_found"
+	CodeRateLimited          = "rate_limited"
+	CodeRequestTooLarge      = "request_too_large"
+	CodeTimeout              = "timeout"
+	CodeUnauthorized         = "unauthorized"
+	CodeUnavailable          = "unavailable"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeValidationFailed     = "validation_failed"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusConflict:              CodeConflict,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusGatewayTimeout:        CodeTimeout,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusRequestEntityTooLarge: CodeRequestTooLarge,
+	http.StatusRequestTimeout:        CodeTimeout,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusUnprocessableEntity:   CodeValidationFailed,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+}
+
+// StatusErrorCode returns the default error code of an HTTP status code. Unknown 4xx status codes are CodeBadRequest
+// and other status codes are CodeInternal.
+func StatusErrorCode(status int) string {
+	code, ok := statusCodes[status]
+	if ok {
+		return code
+	}
+	if status >= 400 && status < 500 {
+		return CodeBadRequest
+	}
+	return CodeInternal
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// JSONOptions configure how ExtractJSON decodes request bodies and how RespondJSON, ErrorResponse, and
+// middleware.WriteErrorBody encode responses. Attach adds AttachArgs.JSON to the context of API handlers.
+type JSONOptions struct {
+	// DisallowUnknownFields rejects request bodies with fields the request type does not have.
+	DisallowUnknownFields bool
+	// Indent, if not empty, indents responses with it, such as two spaces. Attach defaults it to two spaces in
+	// development mode.
+	Indent string
+	// Marshal, if not nil, replaces json.Marshal for responses. Use it to format times or numbers differently, such as
+	// with a marshaler that writes times as Unix timestamps.
+	Marshal func(v any) ([]byte, error)
+	// UseNumber decodes numbers in request fields of type any into json.Number instead of float64, so large integers
+	// keep their precision.
+	UseNumber bool
+}
+
+// WithJSONOptions returns a copy of the context with the JSON options.
+func WithJSONOptions(ctx context.Context, options JSONOptions) context.Context {
+	return context.WithValue(ctx, ctxkey.JSONOptions, options)
+}
+
+// JSONOptionsFrom returns the JSON options of the context, or the zero value if it has none.
+func JSONOptionsFrom(ctx context.Context) JSONOptions {
+	options, _ := ctx.Value(ctxkey.JSONOptions).(JSONOptions)
+	return options
+}
+
+func marshalJSON(ctx context.Context, v any) ([]byte, error) {
+	options := JSONOptionsFrom(ctx)
+	marshal := options.Marshal
+	if marshal == nil {
+		marshal = json.Marshal
+	}
+	b, err := marshal(v)
+	if err != nil || options.Indent == "" {
+		return b, err
+	}
+	var buf bytes.Buffer
+	err = json.Indent(&buf, b, "", options.Indent)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalJSON(ctx context.Context, b []byte, v any) error {
+	options := JSONOptionsFrom(ctx)
+	if !options.DisallowUnknownFields && !options.UseNumber {
+		return json.Unmarshal(b, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if options.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if options.UseNumber {
+		dec.UseNumber()
+	}
+	err := dec.Decode(v)
+	if err != nil {
+		return err
+	}
+	// json.Unmarshal rejects data after the value, so the decoder must too.
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("invalid data after top-level JSON value")
+	}
+	return nil
+}
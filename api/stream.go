@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	hhconst "github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// maxPooledBuffer is the capacity above which a buffer is not returned to the pool, so one large response doesn't hold
+// its memory forever.
+const maxPooledBuffer = 128 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// WriteJSON encodes data, in the envelope of RespondJSON unless the context is marked by WithoutEnvelope, and writes it
+// to the response writer with a Content-Length header. Unlike RespondJSON, the body is encoded into a pooled buffer
+// instead of a new byte slice. The JSONOptions of the context are used. The Content-Length header is not set if the
+// response has a Content-Encoding, because the length of the encoded body is not known.
+//
+// Use it in general handlers or other handlers that write their own response. Nothing is written if encoding fails.
+func WriteJSON(ctx context.Context, w http.ResponseWriter, code int, data any) error {
+	var v any = data
+	if Enveloped(ctx) {
+		reqUUID, _ := ctxkey.ReqUUIDFrom(ctx)
+		v = Response{
+			Data: data,
+			Metadata: Metadata{
+				RequestUUID: reqUUID,
+			},
+		}
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+	options := JSONOptionsFrom(ctx)
+	if options.Marshal != nil {
+		b, err := marshalJSON(ctx, v)
+		if err != nil {
+			return fmt.Errorf("failed to JSON marshal response: %w", err)
+		}
+		buf.Write(b)
+	} else {
+		enc := json.NewEncoder(buf)
+		if options.Indent != "" {
+			enc.SetIndent("", options.Indent)
+		}
+		err := enc.Encode(v)
+		if err != nil {
+			return fmt.Errorf("failed to JSON encode response: %w", err)
+		}
+	}
+
+	w.Header().Set(hhconst.HeaderContentType, hhconst.ContentTypeJSON)
+	if w.Header().Get(hhconst.HeaderContentEncoding) == "" {
+		w.Header().Set(hhconst.HeaderContentLength, strconv.Itoa(buf.Len()))
+	}
+	w.WriteHeader(code)
+	_, err := w.Write(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package httphandle
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/MicahParks/templater"
+	"github.com/google/uuid"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+var _ AppSpecific = BaseApp{}
+
+// BaseApp is an AppSpecific with defaults. Embed it in an application's AppSpecific implementation and override the
+// methods that need to be different, or use it directly in tests.
+//
+// Errors are rendered with a template if one is named and Templater is set. Otherwise, clients that accept JSON get an
+// API error body and other clients get the status text as plain text.
+type BaseApp struct {
+	// ErrorTemplateName, if not empty, is the template ErrorTemplate executes with an ErrorPageData.
+	ErrorTemplateName string
+	// Log is returned by Logger. The default is slog.Default.
+	Log *slog.Logger
+	// NotFoundTemplateName, if not empty, is the template NotFound executes with an ErrorPageData.
+	NotFoundTemplateName string
+	// Templater has the error templates.
+	Templater templater.Templater
+}
+
+// ErrorPageData is the template data of BaseApp's error templates.
+type ErrorPageData struct {
+	Code        int
+	Message     string
+	RequestUUID uuid.UUID
+}
+
+// ErrorTemplate implements AppSpecific. A zero response code is a 500. The headers and cookies of meta are applied.
+func (b BaseApp) ErrorTemplate(meta TemplateRespMeta, r *http.Request, w http.ResponseWriter) {
+	code := meta.ResponseCode
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+	for key, values := range meta.Header {
+		w.Header()[key] = values
+	}
+	for _, cookie := range meta.Cookies {
+		http.SetCookie(w, cookie)
+	}
+	b.writeError(code, b.ErrorTemplateName, r, w)
+}
+
+// Logger implements AppSpecific.
+func (b BaseApp) Logger() *slog.Logger {
+	if b.Log == nil {
+		return slog.Default()
+	}
+	return b.Log
+}
+
+// NotFound implements AppSpecific.
+func (b BaseApp) NotFound(w http.ResponseWriter, r *http.Request) {
+	b.writeError(http.StatusNotFound, b.NotFoundTemplateName, r, w)
+}
+
+func (b BaseApp) writeError(code int, templateName string, r *http.Request, w http.ResponseWriter) {
+	ctx := r.Context()
+	if templateName != "" && b.Templater != nil {
+		reqUUID, _ := ctxkey.ReqUUIDFrom(ctx)
+		w.Header().Set(constant.HeaderContentType, constant.ContentTypeHTML+"; charset=utf-8")
+		w.WriteHeader(code)
+		err := b.Templater.Tmpl().ExecuteTemplate(w, templateName, ErrorPageData{
+			Code:        code,
+			Message:     http.StatusText(code),
+			RequestUUID: reqUUID,
+		})
+		if err != nil {
+			ctxkey.LoggerFrom(ctx).ErrorContext(ctx, "Failed to execute error template.",
+				constant.LogErr, err,
+			)
+		}
+		return
+	}
+	if strings.Contains(r.Header.Get(constant.HeaderAccept), constant.ContentTypeJSON) {
+		middleware.WriteErrorBody(ctx, code, http.StatusText(code)+".", w)
+		return
+	}
+	http.Error(w, http.StatusText(code), code)
+}
@@ -2,42 +2,153 @@
 package httphandle
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/MicahParks/templater"
-	"github.com/google/uuid"
 
+	"github.com/MicahParks/httphandle/api"
 	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/hherr"
+	"github.com/MicahParks/httphandle/livereload"
 	"github.com/MicahParks/httphandle/middleware"
 	"github.com/MicahParks/httphandle/middleware/ctxkey"
+	"github.com/MicahParks/httphandle/middleware/membudget"
+	"github.com/MicahParks/httphandle/middleware/timing"
 )
 
 // AttachArgs are the arguments for attaching handlers to a mux.
 type AttachArgs[A AppSpecific] struct {
-	API            []API[A]
-	Files          http.FileSystem
-	General        []General[A]
-	MiddlewareOpts middleware.GlobalOptions
-	Template       []Template[A]
-	Templater      templater.Templater
+	API     []API[A]
+	Files   http.FileSystem
+	General []General[A]
+	// DevMiddleware is applied to every handler inside the global middleware when DevMode is true. Use it for live
+	// debugging aids like middleware.DebugRequest and middleware.CreateChaos. It and LiveReload are never applied in
+	// binaries built with the httphandle_prod build tag.
+	DevMiddleware []middleware.Middleware
+	// DevMode enables DevMiddleware and development error pages, which show the stack trace, request, and log lines of
+	// panics and template failures instead of AppSpecific.ErrorTemplate. Set it from SetupResults.DevMode.
+	DevMode bool
+	// Host, if not empty, restricts every route to requests for the host, such as "api.example.com". Call Attach once
+	// per host on the same mux to serve different handler sets on different hosts.
+	Host string
+	// JSON configures JSON decoding and encoding in API handlers.
+	JSON api.JSONOptions
+	// LiveReload, if not nil, serves the live reload endpoint and injects its script into template responses.
+	LiveReload *livereload.Reloader
+	// MethodNotAllowed handles requests whose path matches an API handler but whose method does not. The Allow header
+	// is set before it is called. If nil, a 405 error body is written with middleware.WriteErrorBody.
+	MethodNotAllowed http.Handler
+	MiddlewareOpts   middleware.GlobalOptions
+	// MinifyTemplates applies middleware.MinifyHTML to the output of template handlers.
+	MinifyTemplates bool
+	// NoEnvelope sends the responses of API handlers without the data and metadata envelope, with the request UUID in
+	// the constant.HeaderRequestUUID header instead. API handlers that implement Enveloper override it. It also applies
+	// to errors written by the handlers' middleware and to the default 405 response.
+	NoEnvelope bool
+	// NotFound, if not nil, handles requests that match no route. It is registered as the "/" pattern unless an index
+	// template handler is attached, which already uses AppSpecific.NotFound for unknown paths.
+	NotFound http.Handler
+	// Renderer, if not nil, renders template handlers instead of Templater.
+	Renderer Renderer
+	// Routes, if not nil, is populated with every route Attach registers. It is required for RouteTable.Reverse to find
+	// routes named by RouteNamer handlers.
+	Routes *RouteTable
+	// Static are file systems served under their own paths, with the global middleware.
+	Static    []Static
+	Template  []Template[A]
+	Templater templater.Templater
+	// TrailingSlash controls how a path that differs from a pattern only by a trailing slash is handled.
+	TrailingSlash TrailingSlashPolicy
 }
 
-// Attach attaches the handlers to the mux.
+// Router is a router that handlers can be attached to. *http.ServeMux implements it. Routers from other packages, like
+// chi, can be used if they accept http.ServeMux patterns, including a leading method, or through an adapter.
+type Router interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// Attach attaches the handlers to the mux. If AttachArgs.Routes is not nil, it is populated with the registered routes.
 func Attach[A AppSpecific](args AttachArgs[A], a A, mux *http.ServeMux) error {
+	return AttachToRouter(args, a, mux)
+}
+
+// AttachToRouter attaches the handlers to a router. The patterns are checked before anything is registered, so a
+// pattern conflict or invalid method is returned as an error instead of a panic and leaves the router unchanged. A
+// conflict with a route already on the router is also returned as an error, but the routes registered before it remain.
+func AttachToRouter[A AppSpecific](args AttachArgs[A], a A, router Router) error {
 	l := a.Logger()
+	routes := args.Routes
+	if routes != nil {
+		args.Routes = &RouteTable{}
+	}
+	if !devBuild {
+		args.LiveReload = nil
+	}
+	if devBuild && args.DevMode && args.JSON.Indent == "" {
+		args.JSON.Indent = "  "
+	}
 
+	var registrations []registration
+	preflight := make(map[string]bool)
 	for _, handler := range args.API {
 		h, err := createAPIHandler(handler, a)
 		if err != nil {
 			return fmt.Errorf("failed to create an API handler %q: %w", handler.URLPattern(), err)
 		}
 		h = handler.ApplyMiddleware(h)
-		h = middleware.ApplyGlobal(h, l, args.MiddlewareOpts)
-		mux.Handle(handler.URLPattern(), h)
+		h = applyPolicies(handler, h)
+		h = applyDevMiddleware(args, h)
+		h = apiResponseOptions(envelope(args.NoEnvelope, handler), args.JSON)(h)
+		global := globalOptions(args.MiddlewareOpts, handler)
+		h = middleware.ApplyGlobal(h, l, global)
+		h = applyOuterMiddleware(handler, h)
+		registrations = append(registrations, registration{
+			handler: h,
+			pattern: handler.HTTPMethod() + " " + handler.URLPattern(),
+		})
+		reqContentType, respContentType := handler.ContentType()
+		args.Routes.add(Route{
+			Global:              &global,
+			Host:                args.Host,
+			Method:              handler.HTTPMethod(),
+			Middleware:          routeMiddleware(global, handler, devMiddlewareNames(args), policyMiddlewareNames(handler), []string{middlewareNameApplyMiddleware}),
+			Name:                routeName(handler),
+			Pattern:             handler.URLPattern(),
+			RequestContentType:  reqContentType,
+			ResponseContentType: respContentType,
+			Type:                RouteTypeAPI,
+		})
+
+		// The mux only sends requests with the registered method, so CORS preflight requests need their own route.
+		cors, ok := handler.(CORSPolicer)
+		if ok && handler.HTTPMethod() != http.MethodOptions && !preflight[handler.URLPattern()] {
+			preflight[handler.URLPattern()] = true
+			p := middleware.CreateCORS(cors.CORSPolicy())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				middleware.WriteErrorBody(r.Context(), http.StatusMethodNotAllowed, "Method not allowed.", w)
+			}))
+			preflightGlobal := args.MiddlewareOpts
+			p = middleware.ApplyGlobal(p, l, preflightGlobal)
+			registrations = append(registrations, registration{
+				handler: p,
+				pattern: http.MethodOptions + " " + handler.URLPattern(),
+			})
+			args.Routes.add(Route{
+				Global:     &preflightGlobal,
+				Host:       args.Host,
+				Method:     http.MethodOptions,
+				Middleware: routeMiddleware(args.MiddlewareOpts, nil, []string{middlewareNameCORS}),
+				Pattern:    handler.URLPattern(),
+				Type:       RouteTypePreflight,
+			})
+		}
 	}
 
 	for _, handler := range args.Template {
@@ -49,11 +160,33 @@ func Attach[A AppSpecific](args AttachArgs[A], a A, mux *http.ServeMux) error {
 		if handler.URLPattern() == constant.PathIndex {
 			h = createIndexTemplateHandler(a, args, handler)
 		} else {
-			h = handler.ApplyMiddleware(h)
-			h = createTemplateHandler(a, args, handler)
+			h = handler.ApplyMiddleware(createTemplateHandler(a, args, handler))
+		}
+		h = applyPolicies(handler, h)
+		h = applyDevMiddleware(args, h)
+		global := globalOptions(args.MiddlewareOpts, handler)
+		h = middleware.ApplyGlobal(h, l, global)
+		h = applyOuterMiddleware(handler, h)
+		registrations = append(registrations, registration{
+			handler: h,
+			pattern: handler.URLPattern(),
+		})
+		names := []string{middlewareNameApplyMiddleware}
+		if args.LiveReload != nil {
+			names = append(names, middlewareNameLiveReload)
 		}
-		h = middleware.ApplyGlobal(h, l, args.MiddlewareOpts)
-		mux.Handle(handler.URLPattern(), h)
+		if args.MinifyTemplates {
+			names = append(names, middlewareNameMinifyHTML)
+		}
+		args.Routes.add(Route{
+			Global:              &global,
+			Host:                args.Host,
+			Middleware:          routeMiddleware(global, handler, devMiddlewareNames(args), policyMiddlewareNames(handler), names),
+			Name:                routeName(handler),
+			Pattern:             handler.URLPattern(),
+			ResponseContentType: constant.ContentTypeHTML,
+			Type:                RouteTypeTemplate,
+		})
 	}
 
 	for _, handler := range args.General {
@@ -62,47 +195,221 @@ func Attach[A AppSpecific](args AttachArgs[A], a A, mux *http.ServeMux) error {
 			return fmt.Errorf("failed to initialize a general handler %q: %w", handler.URLPattern(), err)
 		}
 		h := handler.ApplyMiddleware(handler)
-		h = middleware.ApplyGlobal(h, l, args.MiddlewareOpts)
-		mux.Handle(handler.URLPattern(), h)
+		h = applyPolicies(handler, h)
+		h = applyDevMiddleware(args, h)
+		global := globalOptions(args.MiddlewareOpts, handler)
+		h = middleware.ApplyGlobal(h, l, global)
+		h = applyOuterMiddleware(handler, h)
+		registrations = append(registrations, registration{
+			handler: h,
+			pattern: handler.URLPattern(),
+		})
+		args.Routes.add(Route{
+			Global:     &global,
+			Host:       args.Host,
+			Middleware: routeMiddleware(global, handler, devMiddlewareNames(args), policyMiddlewareNames(handler), []string{middlewareNameApplyMiddleware}),
+			Name:       routeName(handler),
+			Pattern:    handler.URLPattern(),
+			Type:       RouteTypeGeneral,
+		})
+	}
+
+	for _, static := range args.Static {
+		if static.Files == nil || !strings.HasPrefix(static.Path, "/") {
+			return fmt.Errorf("static file system for path %q must have files and a path starting with a slash", static.Path)
+		}
+		h := createStaticHandler(a, static)
+		h = applyDevMiddleware(args, h)
+		global := args.MiddlewareOpts
+		h = middleware.ApplyGlobal(h, l, global)
+		pattern := staticPattern(static)
+		registrations = append(registrations, registration{
+			handler: h,
+			pattern: pattern,
+		})
+		p := parsePattern(pattern)
+		args.Routes.add(Route{
+			Global:     &global,
+			Host:       args.Host,
+			Method:     p.method,
+			Middleware: routeMiddleware(args.MiddlewareOpts, nil, devMiddlewareNames(args), []string{middlewareNameCacheControl, middlewareNameGzip}),
+			Pattern:    p.path,
+			Type:       RouteTypeStatic,
+		})
+	}
+
+	if args.LiveReload != nil {
+		// The endpoint is long-lived, so it does not get the global request timeout.
+		registrations = append(registrations, registration{
+			handler: args.LiveReload,
+			pattern: livereload.Path,
+		})
+		args.Routes.add(Route{
+			Host:                args.Host,
+			Middleware:          []string{},
+			Pattern:             livereload.Path,
+			ResponseContentType: constant.ContentTypeEventStream,
+			Type:                RouteTypeLiveReload,
+		})
+	}
+
+	var notFound http.Handler = http.HandlerFunc(a.NotFound)
+	if args.NotFound != nil {
+		notFound = args.NotFound
+	}
+	notFound = middleware.ApplyGlobal(notFound, l, args.MiddlewareOpts)
+	registrations = applyTrailingSlash(args.TrailingSlash, registrations, notFound)
+	methodNotAllowed := apiResponseOptions(!args.NoEnvelope, args.JSON)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.WriteErrorBody(r.Context(), http.StatusMethodNotAllowed, "Method not allowed.", w)
+	}))
+	if args.MethodNotAllowed != nil {
+		methodNotAllowed = args.MethodNotAllowed
+	}
+	registrations = append(registrations, methodNotAllowedRegistrations(registrations, middleware.ApplyGlobal(methodNotAllowed, l, args.MiddlewareOpts))...)
+	if args.NotFound != nil && !slices.ContainsFunc(registrations, func(reg registration) bool {
+		return reg.pattern == constant.PathIndex
+	}) {
+		registrations = append(registrations, registration{
+			handler: notFound,
+			pattern: constant.PathIndex,
+		})
+	}
+	for i, reg := range registrations {
+		registrations[i].pattern = withHost(args.Host, reg.pattern)
+	}
+	err := register(router, registrations)
+	if err != nil {
+		return err
+	}
+	if routes != nil {
+		for _, route := range args.Routes.Routes() {
+			routes.Add(route)
+		}
 	}
 
 	return nil
 }
 
+// AttachPrefix attaches the handlers to the router under a path prefix, such as "/api/v2". The handlers' URL patterns are
+// relative to the prefix, and the prefix is stripped from the request path before the handlers see it. This includes
+// the index template handler and its static files, which are served from the prefix itself. The prefix "/" is the
+// same as AttachToRouter.
+func AttachPrefix[A AppSpecific](prefix string, args AttachArgs[A], a A, router Router) error {
+	if prefix == "/" {
+		return AttachToRouter(args, a, router)
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("path prefix %q must start with a slash", prefix)
+	}
+
+	routes := args.Routes
+	if routes != nil {
+		args.Routes = &RouteTable{}
+	}
+	sub := http.NewServeMux()
+	err := Attach(args, a, sub)
+	if err != nil {
+		return err
+	}
+	if routes != nil {
+		for _, route := range args.Routes.Routes() {
+			route.Pattern = prefixPattern(prefix, route.Pattern)
+			routes.Add(route)
+		}
+	}
+
+	return register(router, []registration{{
+		handler: http.StripPrefix(prefix, sub),
+		pattern: args.Host + prefix + "/",
+	}})
+}
+
+// Build attaches the handlers to a new mux and returns it. Use it to embed the handlers in tests, other routers, or
+// adapters that take an http.Handler.
+func Build[A AppSpecific](args AttachArgs[A], a A) (http.Handler, error) {
+	mux := http.NewServeMux()
+	err := Attach(args, a, mux)
+	if err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// ExecuteTemplate executes the inner template, then executes the wrapper template with the inner template's result.
 func ExecuteTemplate(args TemplateArgs, tmplr templater.Templater) error {
+	return ExecuteRenderer(args, renderer(nil, tmplr))
+}
+
+// ExecuteRenderer is ExecuteTemplate with a Renderer, for template engines other than html/template.
+func ExecuteRenderer(args TemplateArgs, tmpl Renderer) error {
 	ctx := args.Request.Context()
 
+	reqData := NewRequestData(args.Request)
+	setter, ok := args.Data.(RequestDataSetter)
+	if ok {
+		setter.SetRequestData(reqData)
+	}
+
+	defer timing.Since(ctx, "template "+args.Name, time.Now())
 	buf := &strings.Builder{}
-	err := tmplr.Tmpl().ExecuteTemplate(buf, args.Name, args.Data)
+	err := tmpl.Render(buf, args.Name, args.Data)
 	if err != nil {
 		return fmt.Errorf("failed to template data: %w", err)
 	}
+	err = membudget.Charge(ctx, int64(buf.Len()))
+	if err != nil {
+		return fmt.Errorf("failed to render template within memory budget: %w", err)
+	}
 
+	reqUUID, _ := ctxkey.ReqUUIDFrom(ctx)
 	result := TemplateDataResult{
 		InnerHTML:    template.HTML(buf.String()),
-		RequestUUID:  ctx.Value(ctxkey.ReqUUID).(uuid.UUID),
+		RequestData:  reqData,
+		RequestUUID:  reqUUID,
 		TemplateArgs: args,
 	}
 
 	headerAddName := args.Name + constant.TemplateHeaderAddExtension
-	headerAdd := tmplr.Tmpl().Lookup(headerAddName)
-	if headerAdd != nil {
+	if tmpl.Lookup(headerAddName) {
 		buf.Reset()
-		err = headerAdd.ExecuteTemplate(buf, headerAddName, args.Data)
+		err = tmpl.Render(buf, headerAddName, args.Data)
 		if err != nil {
 			return fmt.Errorf("failed to template HeaderAdd data: %w", err)
 		}
+		err = membudget.Charge(ctx, int64(buf.Len()))
+		if err != nil {
+			return fmt.Errorf("failed to render template within memory budget: %w", err)
+		}
 		result.HeaderAdd = template.HTML(buf.String())
 	}
 
+	wrappers := args.WrapperNames
+	if len(wrappers) == 0 {
+		wrappers = []string{args.WrapperName}
+	}
+
 	wData := args.WrapperData
+	for _, name := range wrappers[:len(wrappers)-1] {
+		wData.SetResult(result)
+		buf.Reset()
+		err = tmpl.Render(buf, name, wData)
+		if err != nil {
+			return fmt.Errorf("failed to template wrapper %q data: %w", name, err)
+		}
+		err = membudget.Charge(ctx, int64(buf.Len()))
+		if err != nil {
+			return fmt.Errorf("failed to render template within memory budget: %w", err)
+		}
+		result.InnerHTML = template.HTML(buf.String())
+	}
 	wData.SetResult(result)
 
 	if args.ResponseCode == 0 {
 		args.ResponseCode = http.StatusOK
 	}
 	args.Writer.WriteHeader(args.ResponseCode)
-	err = tmplr.Tmpl().ExecuteTemplate(args.Writer, args.WrapperName, wData)
+	err = tmpl.Render(args.Writer, wrappers[len(wrappers)-1], wData)
 	if err != nil {
 		return fmt.Errorf("failed to template wrapper data: %w", err)
 	}
@@ -110,6 +417,95 @@ func ExecuteTemplate(args TemplateArgs, tmplr templater.Templater) error {
 	return nil
 }
 
+// prefixPattern inserts a path prefix into a ServeMux pattern of the form "[METHOD ][HOST]/[PATH]".
+func prefixPattern(prefix, pattern string) string {
+	i := strings.Index(pattern, "/")
+	if i == -1 {
+		return pattern
+	}
+	return pattern[:i] + prefix + pattern[i:]
+}
+
+func applyDevMiddleware[A AppSpecific](args AttachArgs[A], h http.Handler) http.Handler {
+	if !devBuild || !args.DevMode {
+		return h
+	}
+	return devErrorPages(middleware.Wrap(h, args.DevMiddleware...))
+}
+
+func devMiddlewareNames[A AppSpecific](args AttachArgs[A]) []string {
+	if !devBuild || !args.DevMode {
+		return nil
+	}
+	if len(args.DevMiddleware) == 0 {
+		return []string{middlewareNameDevErrorPages}
+	}
+	return []string{middlewareNameDevErrorPages, middlewareNameDev}
+}
+
+func globalOptions(options middleware.GlobalOptions, handler any) middleware.GlobalOptions {
+	policer, ok := handler.(GlobalPolicer)
+	if ok {
+		options = policer.GlobalPolicy(options)
+	}
+	return options
+}
+
+func applyOuterMiddleware(handler any, h http.Handler) http.Handler {
+	outer, ok := handler.(OuterMiddlewarer)
+	if ok {
+		h = outer.ApplyOuterMiddleware(h)
+	}
+	return h
+}
+
+func applyPolicies(handler any, h http.Handler) http.Handler {
+	tx, ok := handler.(TxPolicer)
+	if ok {
+		h = middleware.CreateTxOptions(tx.TxPolicy())(h)
+	}
+	cache, ok := handler.(CachePolicer)
+	if ok {
+		h = middleware.CreateCacheControl(cache.CachePolicy())(h)
+	}
+	bulkhead, ok := handler.(Bulkheader)
+	if ok {
+		h = bulkhead.Bulkhead().Middleware(h)
+	}
+	// CORS is outermost, so responses from the other policies, such as a 503 from a full bulkhead, can be read by
+	// cross-origin clients.
+	cors, ok := handler.(CORSPolicer)
+	if ok {
+		h = middleware.CreateCORS(cors.CORSPolicy())(h)
+	}
+	return h
+}
+
+func envelope(noEnvelope bool, handler any) bool {
+	enveloper, ok := handler.(Enveloper)
+	if ok {
+		return enveloper.Envelope()
+	}
+	return !noEnvelope
+}
+
+// apiResponseOptions adds the JSON options and envelope mode of an API handler to the request context. It is applied
+// just inside the global middleware, so errors written by the handler's own and policy middleware, such as a 401 from
+// middleware.CreateBasicAuth or a 503 from a full bulkhead, have the same shape as the handler's responses.
+func apiResponseOptions(envelope bool, jsonOptions api.JSONOptions) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := api.WithJSONOptions(r.Context(), jsonOptions)
+			if !envelope {
+				reqUUID, _ := ctxkey.ReqUUIDFrom(ctx)
+				w.Header().Set(constant.HeaderRequestUUID, reqUUID.String())
+				ctx = api.WithoutEnvelope(ctx)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func createAPIHandler[A AppSpecific](handler API[A], i A) (http.Handler, error) {
 	err := handler.Initialize(i)
 	if err != nil {
@@ -119,10 +515,6 @@ func createAPIHandler[A AppSpecific](handler API[A], i A) (http.Handler, error)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		if r.Method != handler.HTTPMethod() {
-			middleware.WriteErrorBody(ctx, http.StatusMethodNotAllowed, fmt.Sprintf("Expected %s.", handler.HTTPMethod()), w)
-			return
-		}
 		if r.Header.Get(constant.HeaderContentType) != reqContentType {
 			middleware.WriteErrorBody(ctx, http.StatusUnsupportedMediaType, fmt.Sprintf("Expected %s.", reqContentType), w)
 			return
@@ -134,8 +526,32 @@ func createAPIHandler[A AppSpecific](handler API[A], i A) (http.Handler, error)
 
 		code, body, err := handler.Respond(r)
 		if err != nil {
-			// API handlers shouldn't return errors, so theoretically this should never run.
-			l := r.Context().Value(ctxkey.Logger).(*slog.Logger)
+			l := ctxkey.LoggerFrom(r.Context())
+			hhErr, ok := hherr.As(err)
+			if ok {
+				// The Error may not come from hherr.New, so its code and error code may not be set.
+				code, errorCode := hhErr.Code, hhErr.ErrorCode
+				if code < 100 || code > 999 {
+					code = http.StatusInternalServerError
+				}
+				if errorCode == "" {
+					errorCode = api.StatusErrorCode(code)
+				}
+				// Only the public portion is sent. Client errors are expected, so they are not logged as errors.
+				if hhErr.Err != nil {
+					level := slog.LevelInfo
+					if code >= http.StatusInternalServerError {
+						level = slog.LevelError
+					}
+					l.Log(ctx, level, "API handler returned an error.",
+						constant.LogErr, hhErr.Err,
+						"code", code,
+					)
+				}
+				middleware.WriteErrorBodyCode(ctx, code, errorCode, hhErr.Message, w)
+				return
+			}
+			// API handlers should return *hherr.Error or write the error into the body, so this is unexpected.
 			l.Error("Failed to handle API request.",
 				constant.LogErr, err,
 			)
@@ -152,10 +568,13 @@ func createAPIHandler[A AppSpecific](handler API[A], i A) (http.Handler, error)
 }
 
 func createTemplateHandler[A AppSpecific](a A, attachArgs AttachArgs[A], handler Template[A]) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		l := ctx.Value(ctxkey.Logger).(*slog.Logger)
-
+	var budget time.Duration
+	var fallbackName string
+	budgeter, ok := handler.(RenderBudgeter)
+	if ok {
+		budget, fallbackName = budgeter.RenderBudget()
+	}
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authorized, r, skipTemplate := handler.Authorize(w, r)
 		if !authorized {
 			if !skipTemplate {
@@ -163,45 +582,125 @@ func createTemplateHandler[A AppSpecific](a A, attachArgs AttachArgs[A], handler
 			}
 			return
 		}
-
-		meta, tData, wData := handler.Respond(r)
-
-		for _, cookie := range meta.Cookies {
-			http.SetCookie(w, cookie)
+		if budget <= 0 {
+			respondTemplate(a, attachArgs, handler, w, r)
+			return
 		}
 
-		switch meta.ResponseCode {
-		case 0:
-			meta.ResponseCode = http.StatusOK
-		case http.StatusOK:
-			// Do nothing.
-		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusNotModified, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
-			http.Redirect(w, r, meta.RedirectURL, meta.ResponseCode)
-			return
-		case http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError:
-			l.Warn("Failed to handle template request.",
-				constant.LogRespCode, meta.ResponseCode,
-			)
-			a.ErrorTemplate(meta, r, w)
-			return
-		default:
-			l.Warn("Unexpected response code.",
-				constant.LogRespCode, meta.ResponseCode,
+		// The handler's context is canceled when the budget is exceeded, so its queries stop.
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		budgeted := r.WithContext(ctx)
+		buf := middleware.NewBufferedWriter(nil)
+		// The channel is buffered, so the goroutine can finish after the budget is exceeded.
+		done := make(chan any, 1)
+		go func() {
+			defer func() {
+				done <- recoverPanic(recover())
+			}()
+			respondTemplate(a, attachArgs, handler, buf, budgeted)
+		}()
+		timer := time.NewTimer(budget)
+		defer timer.Stop()
+		select {
+		case rec := <-done:
+			if rec != nil {
+				panic(rec)
+			}
+			buf.CopyTo(w)
+		case <-timer.C:
+			cancel()
+			l := ctxkey.LoggerFrom(r.Context())
+			l.Warn("Template handler exceeded render budget.",
+				constant.LogBudget, budget,
 			)
-			// Proceed.
+			go func() {
+				rec := <-done
+				if rec != nil && rec != http.ErrAbortHandler {
+					l.Error("Template handler panicked after exceeding render budget.",
+						constant.LogErr, rec,
+					)
+				}
+			}()
+			fallback := &bytes.Buffer{}
+			err := renderer(attachArgs.Renderer, attachArgs.Templater).Render(fallback, fallbackName, NewRequestData(r))
+			if err != nil {
+				l.Error("Failed to template fallback data.",
+					constant.LogErr, err,
+				)
+				a.ErrorTemplate(metaFromCode(http.StatusInternalServerError), r, w)
+				return
+			}
+			w.Header().Set(constant.HeaderCacheControl, "no-store")
+			w.Header().Set(constant.HeaderContentType, constant.ContentTypeHTML+"; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write(fallback.Bytes())
 		}
+	})
+	if attachArgs.MinifyTemplates {
+		h = middleware.MinifyHTML(h)
+	}
+	if attachArgs.LiveReload != nil {
+		pages := []string{handler.TemplateName(), handler.WrapperTemplateName()}
+		chain, ok := handler.(WrapperChain)
+		if ok {
+			pages = append(pages[:1], chain.WrapperTemplateNames()...)
+		}
+		h = attachArgs.LiveReload.InjectScript(pages...)(h)
+	}
+	return h
+}
+
+func respondTemplate[A AppSpecific](a A, attachArgs AttachArgs[A], handler Template[A], w http.ResponseWriter, r *http.Request) {
+	l := ctxkey.LoggerFrom(r.Context())
 
-		args := TemplateArgs{
-			Data:         tData,
-			Name:         handler.TemplateName(),
-			Request:      r,
-			ResponseCode: meta.ResponseCode,
-			WrapperData:  wData,
-			WrapperName:  handler.WrapperTemplateName(),
-			Writer:       w,
+	meta, tData, wData := handler.Respond(r)
+
+	for key, values := range meta.Header {
+		w.Header().Del(key)
+		for _, value := range values {
+			w.Header().Add(key, value)
 		}
-		executeTemplate(a, args, attachArgs.Templater)
-	})
+	}
+	for _, cookie := range meta.Cookies {
+		http.SetCookie(w, cookie)
+	}
+
+	switch meta.ResponseCode {
+	case 0:
+		meta.ResponseCode = http.StatusOK
+	case http.StatusOK:
+		// Do nothing.
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusNotModified, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		http.Redirect(w, r, meta.RedirectURL, meta.ResponseCode)
+		return
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError:
+		l.Warn("Failed to handle template request.",
+			constant.LogRespCode, meta.ResponseCode,
+		)
+		a.ErrorTemplate(meta, r, w)
+		return
+	default:
+		l.Warn("Unexpected response code.",
+			constant.LogRespCode, meta.ResponseCode,
+		)
+		// Proceed.
+	}
+
+	args := TemplateArgs{
+		Data:         tData,
+		Name:         handler.TemplateName(),
+		Request:      r,
+		ResponseCode: meta.ResponseCode,
+		WrapperData:  wData,
+		WrapperName:  handler.WrapperTemplateName(),
+		Writer:       w,
+	}
+	chain, ok := handler.(WrapperChain)
+	if ok {
+		args.WrapperNames = chain.WrapperTemplateNames()
+	}
+	executeTemplate(a, args, renderer(attachArgs.Renderer, attachArgs.Templater))
 }
 
 func createIndexTemplateHandler[A AppSpecific](a A, attachArgs AttachArgs[A], handler Template[A]) http.Handler {
@@ -223,13 +722,16 @@ func createIndexTemplateHandler[A AppSpecific](a A, attachArgs AttachArgs[A], ha
 	})
 }
 
-func executeTemplate[A AppSpecific](a A, args TemplateArgs, tmplr templater.Templater) {
-	err := ExecuteTemplate(args, tmplr)
+func executeTemplate[A AppSpecific](a A, args TemplateArgs, tmpl Renderer) {
+	err := ExecuteRenderer(args, tmpl)
 	if err != nil {
-		l := args.Request.Context().Value(ctxkey.Logger).(*slog.Logger)
+		l := ctxkey.LoggerFrom(args.Request.Context())
 		l.Error("Failed to template JS data.",
 			constant.LogErr, err,
 		)
+		if writeDevErrorPage(args.Writer, args.Request, "Template failure", err.Error(), nil) {
+			return
+		}
 		a.ErrorTemplate(metaFromCode(http.StatusInternalServerError), args.Request, args.Writer)
 	}
 }
@@ -0,0 +1,487 @@
+package httphandle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	jt "github.com/MicahParks/jsontype"
+)
+
+const (
+	// ConfigSourceDefault means no source set the field, so it has its zero value or the value from
+	// DefaultsAndValidate.
+	ConfigSourceDefault = "default"
+	// ConfigSourceEnv means an environment variable set the field.
+	ConfigSourceEnv = "env"
+	// ConfigSourceFile means a file named by an environment variable with the _FILE suffix set the field.
+	ConfigSourceFile = "file"
+	// ConfigSourceFlag means a command-line flag set the field.
+	ConfigSourceFlag = "flag"
+	// ConfigSourceJSON means the JSON configuration set the field.
+	ConfigSourceJSON = "json"
+	// ConfigSourceOverlay means the environment's overlay file set the field.
+	ConfigSourceOverlay = "overlay"
+)
+
+// ConfigOptions layer an environment's overlay file, environment variables, and command-line flags over the JSON
+// configuration. The precedence, from lowest to highest, is the JSON configuration, the overlay, environment variables,
+// then flags. DefaultsAndValidate runs after all of them are merged. Only top-level fields of the configuration can be
+// overridden, and their keys in JSON match case-insensitively, like encoding/json. A value is parsed as JSON if it fits
+// the field, such as a number, boolean, or object, and is used as a JSON string otherwise.
+type ConfigOptions struct {
+	// Args are the command-line arguments, usually os.Args[1:]. Every top-level field is a flag named after its JSON
+	// key, such as -port=8080. Other arguments, such as the application's own flags, are ignored. If nil, flags aren't
+	// parsed.
+	Args []string
+	// Env enables environment variables. Every top-level field is read from EnvPrefix plus its JSON key in upper snake
+	// case, such as APP_LOG_LEVEL for "logLevel" with the "APP_" prefix. If that variable isn't set, but the same name
+	// with the _FILE suffix is, the field is read from the file it names, like Docker and Kubernetes secrets. One
+	// trailing newline is removed from the file.
+	Env       bool
+	EnvPrefix string
+	// ExpandEnv replaces ${NAME} in the string values of the JSON configuration with the environment variable NAME,
+	// so secrets like DSNs don't have to be in the file. A referenced variable that isn't set is an error.
+	ExpandEnv bool
+	// OverlayEnv is the name of an environment variable, such as "APP_ENV", naming the environment. If it is set, the
+	// overlay file for the environment is merged over the JSON configuration file. The overlay file is next to the
+	// configuration file, with the environment before the extension, such as config.prod.json. Objects are merged
+	// recursively and other values are replaced. It is an error if the overlay file doesn't exist.
+	OverlayEnv string
+}
+
+type configField struct {
+	env string
+	key string
+	typ reflect.Type
+}
+
+// rawConfig is the JSON configuration before it is merged and decoded. Reading it with jsontype.Read finds and
+// unmarshals the configuration the same way as for the configuration type, without applying defaults yet.
+type rawConfig map[string]json.RawMessage
+
+func (r rawConfig) DefaultsAndValidate() (rawConfig, error) {
+	return r, nil
+}
+
+// readConfig reads the configuration with jsontype.Read, then applies the overrides in options. It returns the source
+// of every top-level field by JSON key. If an override is enabled, a missing configuration file is treated as empty.
+func readConfig[C jt.Defaulter[C]](options ConfigOptions) (C, map[string]string, error) {
+	var config C
+	overrides := options.Env || options.Args != nil
+
+	configPath := os.Getenv(jt.EnvVarConfigPath)
+	if configPath == "" {
+		configPath = "config.json"
+	}
+	merged, err := jt.Read[rawConfig]()
+	if errors.Is(err, os.ErrNotExist) && overrides {
+		merged, err = nil, nil
+	}
+	if err != nil {
+		return config, nil, err
+	}
+	if merged == nil {
+		merged = make(rawConfig)
+	}
+	fields := configFields(reflect.TypeOf(config), options.EnvPrefix)
+	merged.normalize(fields)
+
+	var overlaid []string
+	env := ""
+	if options.OverlayEnv != "" {
+		env = os.Getenv(options.OverlayEnv)
+	}
+	if env != "" {
+		ext := filepath.Ext(configPath)
+		overlayPath := strings.TrimSuffix(configPath, ext) + "." + env + ext
+		b, err := os.ReadFile(overlayPath)
+		if err != nil {
+			return config, nil, fmt.Errorf("failed to read config overlay file for environment %q: %w", env, err)
+		}
+		var overlay rawConfig
+		err = json.Unmarshal(b, &overlay)
+		if err != nil {
+			return config, nil, fmt.Errorf("failed to unmarshal config overlay file at path: %q: %w", overlayPath, err)
+		}
+		overlay.normalize(fields)
+		for key, raw := range overlay {
+			merged[key] = mergeJSON(merged[key], raw)
+			overlaid = append(overlaid, key)
+		}
+	}
+
+	if options.ExpandEnv {
+		for key, raw := range merged {
+			merged[key], err = expandEnv(raw)
+			if err != nil {
+				return config, nil, fmt.Errorf("failed to expand environment variables in configuration field %q: %w", key, err)
+			}
+		}
+	}
+
+	sources := make(map[string]string, len(fields))
+	for _, field := range fields {
+		sources[field.key] = ConfigSourceDefault
+		if _, ok := merged[field.key]; ok {
+			sources[field.key] = ConfigSourceJSON
+		}
+	}
+	for _, key := range overlaid {
+		if _, ok := sources[key]; ok {
+			sources[key] = ConfigSourceOverlay
+		}
+	}
+
+	if options.Env {
+		for _, field := range fields {
+			value, ok := os.LookupEnv(field.env)
+			if ok {
+				merged[field.key] = configValue(value, field.typ)
+				sources[field.key] = ConfigSourceEnv
+				continue
+			}
+			path, ok := os.LookupEnv(field.env + "_FILE")
+			if !ok {
+				continue
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return config, nil, fmt.Errorf("failed to read configuration field %q from file named by %s_FILE: %w", field.key, field.env, err)
+			}
+			b = bytes.TrimSuffix(bytes.TrimSuffix(b, []byte("\n")), []byte("\r"))
+			merged[field.key] = configValue(string(b), field.typ)
+			sources[field.key] = ConfigSourceFile
+		}
+	}
+
+	if options.Args != nil {
+		set := flag.NewFlagSet("config", flag.ContinueOnError)
+		set.SetOutput(io.Discard)
+		values := make(map[string]*string, len(fields))
+		types := make(map[string]reflect.Type, len(fields))
+		for _, field := range fields {
+			values[field.key] = set.String(field.key, "", "Overrides the "+field.key+" configuration field.")
+			types[field.key] = field.typ
+		}
+		err = set.Parse(configArgs(options.Args, values))
+		if err != nil {
+			return config, nil, fmt.Errorf("failed to parse configuration flags: %w", err)
+		}
+		set.Visit(func(f *flag.Flag) {
+			merged[f.Name] = configValue(*values[f.Name], types[f.Name])
+			sources[f.Name] = ConfigSourceFlag
+		})
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return config, nil, fmt.Errorf("failed to marshal merged configuration: %w", err)
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return config, nil, fmt.Errorf("failed to unmarshal merged configuration: %w", err)
+	}
+	validated, err := config.DefaultsAndValidate()
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+		validated = config
+	}
+	errs = append(errs, validateFields(reflect.ValueOf(validated), "")...)
+	if len(errs) != 0 {
+		return validated, nil, fmt.Errorf("failed to apply defaults and validate configuration: %w", errors.Join(errs...))
+	}
+	return validated, sources, nil
+}
+
+// normalize renames the keys that encoding/json would decode into a top-level field, which it matches
+// case-insensitively, to the field's JSON key. An exact match wins over the others.
+func (r rawConfig) normalize(fields []configField) {
+	for _, field := range fields {
+		for key, raw := range r {
+			if key == field.key || !strings.EqualFold(key, field.key) {
+				continue
+			}
+			if _, ok := r[field.key]; !ok {
+				r[field.key] = raw
+			}
+			delete(r, key)
+		}
+	}
+}
+
+// configArgs returns the arguments that set one of the flags in values, so the application's own flags and
+// positional arguments are ignored. An unknown flag without an equals sign is assumed to take the argument after it,
+// unless that argument looks like another flag.
+func configArgs(args []string, values map[string]*string) []string {
+	var known []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimPrefix(arg[1:], "-"), "=")
+		if _, ok := values[name]; ok {
+			known = append(known, arg)
+			if !hasValue && i+1 < len(args) {
+				i++
+				known = append(known, args[i])
+			}
+			continue
+		}
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+		}
+	}
+	return known
+}
+
+// mergeJSON merges overlay into base if both are JSON objects. Otherwise, overlay replaces base.
+func mergeJSON(base, overlay json.RawMessage) json.RawMessage {
+	var baseObj, overlayObj map[string]json.RawMessage
+	if json.Unmarshal(base, &baseObj) != nil || baseObj == nil {
+		return overlay
+	}
+	if json.Unmarshal(overlay, &overlayObj) != nil || overlayObj == nil {
+		return overlay
+	}
+	for key, raw := range overlayObj {
+		baseObj[key] = mergeJSON(baseObj[key], raw)
+	}
+	merged, err := json.Marshal(baseObj)
+	if err != nil {
+		return overlay
+	}
+	return merged
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces environment variable references in the strings of a JSON value.
+func expandEnv(raw json.RawMessage) (json.RawMessage, error) {
+	if !bytes.Contains(raw, []byte("${")) {
+		return raw, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	v, err = expandEnvValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func expandEnvValue(v any) (any, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		var missing []string
+		expanded := envReference.ReplaceAllStringFunc(v, func(ref string) string {
+			name := ref[2 : len(ref)-1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) != 0 {
+			return nil, fmt.Errorf("environment variables referenced by configuration aren't set: %s", strings.Join(missing, ", "))
+		}
+		return expanded, nil
+	case []any:
+		for i := range v {
+			v[i], err = expandEnvValue(v[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		for key := range v {
+			v[key], err = expandEnvValue(v[key])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// ConfigError is a validation error of the configuration value at a JSON path, such as "postgres.dsn" or
+// "upstreams[1]". A struct field of the configuration tagged with `config:"validate"` opts into nested validation:
+// after the configuration's own DefaultsAndValidate, DefaultsAndValidate is called on the field's value, or on every
+// element if it is a slice, array, or map, and all the failures are reported together as ConfigErrors. Tagged fields of
+// those values are validated the same way.
+type ConfigError struct {
+	Err  error
+	Path string
+}
+
+func (c ConfigError) Error() string {
+	return c.Path + ": " + c.Err.Error()
+}
+
+func (c ConfigError) Unwrap() error {
+	return c.Err
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// validateFields validates the fields of the struct v tagged with `config:"validate"`, depth first, and returns all
+// the failures as ConfigErrors. v itself isn't validated.
+func validateFields(v reflect.Value, path string) []error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get("config") != "validate" {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = f.Name
+		}
+		if path != "" {
+			key = path + "." + key
+		}
+		errs = append(errs, validateField(v.Field(i), key)...)
+	}
+	return errs
+}
+
+// validateField validates the value of a tagged field, or its elements if it is a slice, array, or map.
+func validateField(v reflect.Value, path string) []error {
+	var errs []error
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, key := range keys {
+			errs = append(errs, validateValue(v.MapIndex(key), path+"."+fmt.Sprint(key))...)
+		}
+	default:
+		errs = validateValue(v, path)
+	}
+	return errs
+}
+
+// validateValue calls DefaultsAndValidate on v if it has it. A value whose own tagged fields fail isn't validated
+// itself, since it would only report the first of the same failures.
+func validateValue(v reflect.Value, path string) []error {
+	errs := validateFields(v, path)
+	if len(errs) != 0 {
+		return errs
+	}
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil
+	}
+	m := v.MethodByName("DefaultsAndValidate")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 2 || m.Type().Out(1) != errorType {
+		return nil
+	}
+	err, _ := m.Call(nil)[1].Interface().(error)
+	if err != nil {
+		return []error{ConfigError{
+			Err:  err,
+			Path: path,
+		}}
+	}
+	return nil
+}
+
+// configFields returns the top-level fields of a configuration struct by JSON key.
+func configFields(t reflect.Type, envPrefix string) []configField {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []configField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = f.Name
+		}
+		fields = append(fields, configField{
+			env: envPrefix + upperSnake(key),
+			key: key,
+			typ: f.Type,
+		})
+	}
+	return fields
+}
+
+// configValue returns value as JSON if it unmarshals into a value of type t, otherwise as a JSON string.
+func configValue(value string, t reflect.Type) json.RawMessage {
+	raw := []byte(value)
+	err := json.Unmarshal(raw, reflect.New(t).Interface())
+	if err == nil {
+		return raw
+	}
+	raw, _ = json.Marshal(value)
+	return raw
+}
+
+// upperSnake converts a JSON key like "logLevel" or "log-level" to "LOG_LEVEL".
+func upperSnake(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if r == '-' || r == '.' || r == ' ' {
+			b.WriteRune('_')
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 && runes[i-1] != '_' {
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(runes[i-1]) || nextLower {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,249 @@
+// Package consent stores cookie consent preferences in a signed cookie and gates scripts in templates on them.
+package consent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/httphandle"
+	"github.com/MicahParks/httphandle/api"
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+const (
+	// CategoryNecessary is the consent category that is always granted.
+	CategoryNecessary = "necessary"
+	// CookieName is the default name of the consent cookie.
+	CookieName = "hh_consent"
+	// DefaultMaxAge is the default lifetime of the consent cookie.
+	DefaultMaxAge = 180 * 24 * time.Hour
+	// FuncConsented is the name of the template function added by FuncMap.
+	FuncConsented = "consented"
+	// URLPattern is the default URL pattern for the preferences handler.
+	URLPattern = "POST /api/consent"
+)
+
+// ErrInvalidCookie is returned when the consent cookie is malformed or its signature does not match.
+var ErrInvalidCookie = errors.New("invalid consent cookie")
+
+// Options are the options for a Manager.
+type Options struct {
+	// Categories are the consent categories users can choose, such as "analytics" and "marketing".
+	Categories []string
+	CookieName string
+	// Key signs the consent cookie. It should be at least 32 random bytes.
+	Key    []byte
+	MaxAge time.Duration
+	Secure bool
+}
+
+// Preferences are the consent choices of a user. A nil value means the user has not chosen yet.
+type Preferences map[string]bool
+
+// Allowed reports whether the user consented to the category.
+func (p Preferences) Allowed(category string) bool {
+	if category == CategoryNecessary {
+		return true
+	}
+	return p[category]
+}
+
+// Chosen reports whether the user has saved their preferences.
+func (p Preferences) Chosen() bool {
+	return p != nil
+}
+
+// Manager reads and writes consent preferences.
+type Manager struct {
+	options Options
+}
+
+// NewManager creates a Manager.
+func NewManager(options Options) (*Manager, error) {
+	if len(options.Key) < 32 {
+		return nil, fmt.Errorf("consent key must be at least 32 bytes, got %d", len(options.Key))
+	}
+	if options.CookieName == "" {
+		options.CookieName = CookieName
+	}
+	if options.MaxAge == 0 {
+		options.MaxAge = DefaultMaxAge
+	}
+	return &Manager{
+		options: options,
+	}, nil
+}
+
+// Cookie creates the signed cookie for the preferences. Unknown categories are dropped.
+func (m *Manager) Cookie(p Preferences) (*http.Cookie, error) {
+	clean := make(Preferences, len(m.options.Categories))
+	for _, category := range m.options.Categories {
+		clean[category] = p[category]
+	}
+	payload, err := json.Marshal(clean)
+	if err != nil {
+		return nil, fmt.Errorf("failed to JSON marshal consent preferences: %w", err)
+	}
+	value := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(m.sign(payload))
+	return &http.Cookie{
+		HttpOnly: true,
+		MaxAge:   int(m.options.MaxAge / time.Second),
+		Name:     m.options.CookieName,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		Secure:   m.options.Secure,
+		Value:    value,
+	}, nil
+}
+
+// FuncMap returns the template functions for gating content on consent. The "consented" function takes the
+// Preferences and a category:
+//
+//	{{if consented .Consent "analytics"}}<script src="/analytics.js"></script>{{end}}
+func (m *Manager) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		FuncConsented: func(p Preferences, category string) bool {
+			return p.Allowed(category)
+		},
+	}
+}
+
+// Read returns the preferences stored in the request's consent cookie. If there is no valid cookie, the returned
+// Preferences are nil.
+func (m *Manager) Read(r *http.Request) Preferences {
+	cookie, err := r.Cookie(m.options.CookieName)
+	if err != nil {
+		return nil
+	}
+	p, err := m.parse(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+func (m *Manager) parse(value string) (Preferences, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalidCookie
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCookie, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCookie, err)
+	}
+	if !hmac.Equal(sig, m.sign(payload)) {
+		return nil, ErrInvalidCookie
+	}
+	var p Preferences
+	err = json.Unmarshal(payload, &p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCookie, err)
+	}
+	if p == nil {
+		p = Preferences{}
+	}
+	return p, nil
+}
+
+func (m *Manager) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, m.options.Key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// UpdateRequest is the request body for the preferences handler.
+type UpdateRequest struct {
+	Categories Preferences `json:"categories"`
+}
+
+// Handler is a general handler that saves the user's consent preferences from a JSON request body. It responds with
+// the saved preferences.
+type Handler[A httphandle.AppSpecific] struct {
+	Manager *Manager
+	// Pattern is the URL pattern. If empty, URLPattern is used.
+	Pattern string
+}
+
+func (h Handler[A]) ApplyMiddleware(next http.Handler) http.Handler {
+	return next
+}
+
+func (h Handler[A]) Initialize(A) error {
+	if h.Manager == nil {
+		return errors.New("consent handler requires a Manager")
+	}
+	return nil
+}
+
+func (h Handler[A]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := ctxkey.LoggerFrom(ctx)
+
+	if r.Header.Get(constant.HeaderContentType) != constant.ContentTypeJSON {
+		middleware.WriteErrorBody(ctx, http.StatusUnsupportedMediaType, fmt.Sprintf("Expected %s.", constant.ContentTypeJSON), w)
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		middleware.WriteReadBodyError(ctx, err, w)
+		return
+	}
+	var reqData UpdateRequest
+	err = json.Unmarshal(b, &reqData)
+	if err != nil {
+		middleware.WriteErrorBody(ctx, http.StatusBadRequest, "Failed to JSON parse request body.", w)
+		return
+	}
+	for category := range reqData.Categories {
+		if category != CategoryNecessary && !slices.Contains(h.Manager.options.Categories, category) {
+			middleware.WriteErrorBody(ctx, http.StatusUnprocessableEntity, fmt.Sprintf("Unknown consent category %q.", category), w)
+			return
+		}
+	}
+
+	cookie, err := h.Manager.Cookie(reqData.Categories)
+	if err != nil {
+		l.ErrorContext(ctx, "Failed to create consent cookie.",
+			constant.LogErr, err,
+		)
+		middleware.WriteErrorBody(ctx, http.StatusInternalServerError, constant.RespInternalServerError, w)
+		return
+	}
+	saved, _ := h.Manager.parse(cookie.Value)
+
+	code, body, err := api.RespondJSON(ctx, http.StatusOK, saved)
+	if err != nil {
+		l.ErrorContext(ctx, "Failed to create consent response.",
+			constant.LogErr, err,
+		)
+		middleware.WriteErrorBody(ctx, http.StatusInternalServerError, constant.RespInternalServerError, w)
+		return
+	}
+	http.SetCookie(w, cookie)
+	w.Header().Set(constant.HeaderContentType, constant.ContentTypeJSON)
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
+
+func (h Handler[A]) URLPattern() string {
+	if h.Pattern == "" {
+		return URLPattern
+	}
+	return h.Pattern
+}
@@ -2,20 +2,62 @@
 package constant
 
 const (
+	// HeaderAccessControlAllowCredentials is the header key for allowing credentials in CORS requests.
+	HeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	// HeaderAccessControlAllowHeaders is the header key for the headers allowed in CORS requests.
+	HeaderAccessControlAllowHeaders = "Access-Control-Allow-Headers"
+	// HeaderAccessControlAllowMethods is the header key for the methods allowed in CORS requests.
+	HeaderAccessControlAllowMethods = "Access-Control-Allow-Methods"
+	// HeaderAccessControlAllowOrigin is the header key for the origin allowed in CORS requests.
+	HeaderAccessControlAllowOrigin = "Access-Control-Allow-Origin"
+	// HeaderAccessControlExposeHeaders is the header key for the headers exposed to CORS requests.
+	HeaderAccessControlExposeHeaders = "Access-Control-Expose-Headers"
+	// HeaderAccessControlMaxAge is the header key for how long a CORS preflight response can be cached.
+	HeaderAccessControlMaxAge = "Access-Control-Max-Age"
+	// HeaderAccessControlRequestMethod is the header key for the method of a CORS preflight request.
+	HeaderAccessControlRequestMethod = "Access-Control-Request-Method"
+	// HeaderRequestUUID is the header key for the request UUID of API responses without an envelope.
+	HeaderRequestUUID = "Request-UUID"
+	// HeaderOrigin is the header key for the request origin.
+	HeaderOrigin = "Origin"
+	// HeaderVary is the header key for the headers that vary a response.
+	HeaderVary = "Vary"
+	// HeaderAccept is the header key for the accepted content types.
+	HeaderAccept = "Accept"
 	// HeaderAcceptEncoding is the header key for the accepted encodings.
 	HeaderAcceptEncoding = "Accept-Encoding"
+	// HeaderAllow is the header key for the methods allowed on a resource.
+	HeaderAllow = "Allow"
 	// HeaderCacheControl is the header key for the cache control.
 	HeaderCacheControl = "Cache-Control"
+	// HeaderContentDigest is the header key for the digest of the content.
+	HeaderContentDigest = "Content-Digest"
 	// HeaderContentEncoding is the header key for the content encoding.
 	HeaderContentEncoding = "Content-Encoding"
+	// HeaderSignature is the header key for HTTP message signatures.
+	HeaderSignature = "Signature"
+	// HeaderSignatureInput is the header key for the covered components and parameters of HTTP message signatures.
+	HeaderSignatureInput = "Signature-Input"
+	// HeaderWWWAuthenticate is the header key for the authentication scheme of a 401 response.
+	HeaderWWWAuthenticate = "WWW-Authenticate"
 	// ContentEncodingGzip is the content encoding for gzip.
 	ContentEncodingGzip = "gzip"
+	// HeaderConnection is the header key for the connection options.
+	HeaderConnection = "Connection"
+	// HeaderContentLength is the header key for the content length.
+	HeaderContentLength = "Content-Length"
 	// HeaderContentType is the header key for the content type.
 	HeaderContentType = "Content-Type"
 	// ContentTypeForm is the content type for form data.
 	ContentTypeForm = "application/x-www-form-urlencoded"
+	// ContentTypeEventStream is the content type for server-sent events.
+	ContentTypeEventStream = "text/event-stream"
+	// ContentTypeHTML is the content type for HTML documents.
+	ContentTypeHTML = "text/html"
 	// ContentTypeJSON is the content type for JSON data.
 	ContentTypeJSON = "application/json"
+	// ContentTypeNDJSON is the content type for newline delimited JSON.
+	ContentTypeNDJSON = "application/x-ndjson"
 	// MsgFailTransactionBegin is the log message for a failed transaction start.
 	MsgFailTransactionBegin = "Failed to begin transaction."
 	// MsgFailTransactionCommit is the log message for a failed transaction commit.
@@ -24,16 +66,34 @@ const (
 	MsgFailTransactionRollback = "Failed to rollback transaction."
 	// LogFmt is the format for logging with the built-in logger.
 	LogFmt = "%s\nError: %v"
+	// LogBudget is the key for a time budget in slog fields.
+	LogBudget = "budget"
+	// LogCount is the key for a count in slog fields.
+	LogCount = "count"
+	// LogDuration is the key for a duration in slog fields.
+	LogDuration = "duration"
 	// LogErr is the key for the error in slog fields.
 	LogErr = "error"
+	// LogFiles is the key for a list of file paths in slog fields.
+	LogFiles = "files"
+	// LogHeader is the key for HTTP headers in slog fields.
+	LogHeader = "header"
+	// LogInFlight is the key for the number of requests being handled in slog fields.
+	LogInFlight = "inFlight"
 	// LogRespCode is the key for the response code in slog fields.
 	LogRespCode = "respCode"
+	// LogTask is the key for the name of a supervised goroutine in slog fields.
+	LogTask = "task"
 	// PathIndex is the path for the index page.
 	PathIndex = "/"
 	// RespInternalServerError is the response message for an internal server error.
 	RespInternalServerError = "Internal server error."
 	// StaticDir is the directory for static files.
 	StaticDir = "static"
+	// TemplatesDir is the directory for template files.
+	TemplatesDir = "templates"
+	// TemplatesPattern is the glob pattern for template files.
+	TemplatesPattern = "*.gohtml"
 	// TemplateHeaderAddExtension is the extension for extra HTML to add to the header. files.
 	TemplateHeaderAddExtension = ".header"
 )
@@ -0,0 +1,329 @@
+package httphandle
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/templater"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// DefaultContentWatchInterval is the default interval ContentSwapper.Watch checks the content bundle directory.
+const DefaultContentWatchInterval = 2 * time.Second
+
+// ContentBundleOptions are the options for loading content bundles with ContentSwapper.AdminHandler and
+// ContentSwapper.Watch.
+type ContentBundleOptions struct {
+	FuncMap template.FuncMap
+	// Interval is how often Watch checks the content bundle directory. The default is DefaultContentWatchInterval.
+	Interval time.Duration
+	// Logger is used by Watch. The default is slog.Default.
+	Logger *slog.Logger
+	// StaticDir is the directory of the bundle that static files are served from. The default is constant.StaticDir.
+	// Use the same value as SetupArgs.StaticDir.
+	StaticDir string
+	// TemplatesDir is the directory of the bundle that templates are parsed from. The default is
+	// constant.TemplatesDir. Use the same value as SetupArgs.TemplatesDir.
+	TemplatesDir string
+	// TemplatesPattern is the glob pattern of template files in the templates directory. The default is
+	// constant.TemplatesPattern. Use the same value as SetupArgs.TemplatesPattern.
+	TemplatesPattern string
+	// Validate, if not nil, is called with the new templates before they are swapped in.
+	Validate func(tmpl *template.Template) error
+}
+
+func (o ContentBundleOptions) withDefaults() ContentBundleOptions {
+	if o.StaticDir == "" {
+		o.StaticDir = constant.StaticDir
+	}
+	if o.TemplatesDir == "" {
+		o.TemplatesDir = constant.TemplatesDir
+	}
+	if o.TemplatesPattern == "" {
+		o.TemplatesPattern = constant.TemplatesPattern
+	}
+	return o
+}
+
+// ContentSwapper holds the templates and static files and lets them be replaced at runtime without restarting. It
+// implements templater.Templater and http.FileSystem, so pass it as AttachArgs.Templater and AttachArgs.Files. Content
+// can be swapped from an admin endpoint with AdminHandler or when a directory changes with Watch. It is safe for
+// concurrent use.
+type ContentSwapper struct {
+	files    http.FileSystem
+	mux      sync.RWMutex
+	previous *content
+	tmpl     *template.Template
+	tmplr    templater.Templater
+}
+
+type content struct {
+	files http.FileSystem
+	tmpl  *template.Template
+	tmplr templater.Templater
+}
+
+// NewContentSwapper creates a ContentSwapper serving the given templates and static files.
+func NewContentSwapper(tmplr templater.Templater, files http.FileSystem) *ContentSwapper {
+	return &ContentSwapper{
+		files: files,
+		tmplr: tmplr,
+	}
+}
+
+// Open implements http.FileSystem using the current static files.
+func (c *ContentSwapper) Open(name string) (http.File, error) {
+	c.mux.RLock()
+	files := c.files
+	c.mux.RUnlock()
+	return files.Open(name)
+}
+
+// Tmpl implements templater.Templater using the current templates.
+func (c *ContentSwapper) Tmpl() *template.Template {
+	c.mux.RLock()
+	tmpl, tmplr := c.tmpl, c.tmplr
+	c.mux.RUnlock()
+	if tmpl != nil {
+		return tmpl
+	}
+	return tmplr.Tmpl()
+}
+
+// Swap replaces the templates and static files. The new templates are parsed and passed to validate, if not nil,
+// before anything is replaced, so a bad content bundle leaves the current content in place. A nil files keeps the
+// current static files.
+func (c *ContentSwapper) Swap(tmplr templater.Templater, files http.FileSystem, validate func(tmpl *template.Template) error) error {
+	tmpl, err := parseTemplater(tmplr)
+	if err != nil {
+		return err
+	}
+	return c.swap(content{
+		files: files,
+		tmplr: tmplr,
+	}, tmpl, validate)
+}
+
+// SwapBundle replaces the content with a bundle, such as os.DirFS of a freshly downloaded directory. The bundle's
+// templates and static files are read from the directories in options, which default to the same ones as Setup. The
+// templates are parsed once and validated with options.Validate before anything is replaced.
+func (c *ContentSwapper) SwapBundle(bundle fs.FS, options ContentBundleOptions) error {
+	options = options.withDefaults()
+	templates, err := fs.Sub(bundle, options.TemplatesDir)
+	if err != nil {
+		return fmt.Errorf("failed to get templates directory of content bundle: %w", err)
+	}
+	tmpl, err := template.New("").Funcs(options.FuncMap).ParseFS(templates, options.TemplatesPattern)
+	if err != nil {
+		return fmt.Errorf("failed to parse templates of content bundle: %w", err)
+	}
+	static, err := fs.Sub(bundle, options.StaticDir)
+	if err != nil {
+		return fmt.Errorf("failed to get static directory of content bundle: %w", err)
+	}
+	return c.swap(content{
+		files: http.FS(static),
+		tmpl:  tmpl,
+	}, tmpl, options.Validate)
+}
+
+// Rollback restores the content from before the last successful swap. Only one previous version is kept.
+func (c *ContentSwapper) Rollback() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.previous == nil {
+		return errors.New("no previous content to roll back to")
+	}
+	c.files, c.tmpl, c.tmplr = c.previous.files, c.previous.tmpl, c.previous.tmplr
+	c.previous = nil
+	return nil
+}
+
+func (c *ContentSwapper) swap(next content, tmpl *template.Template, validate func(tmpl *template.Template) error) error {
+	if validate != nil {
+		err := validate(tmpl)
+		if err != nil {
+			return fmt.Errorf("failed to validate new templates: %w", err)
+		}
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if next.files == nil {
+		next.files = c.files
+	}
+	c.previous = &content{
+		files: c.files,
+		tmpl:  c.tmpl,
+		tmplr: c.tmplr,
+	}
+	c.files, c.tmpl, c.tmplr = next.files, next.tmpl, next.tmplr
+	return nil
+}
+
+// AdminHandler returns an admin handler for content deploys. POST calls load to get a new content bundle, such as by
+// pulling it into a new directory and returning os.DirFS of it, and swaps it in with SwapBundle. DELETE rolls back to
+// the previous content. Attach it with WrapGeneral behind authentication, such as middleware.CreateBasicAuth.
+func (c *ContentSwapper) AdminHandler(load func(ctx context.Context) (fs.FS, error), options ContentBundleOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		l := ctxkey.LoggerFrom(ctx)
+		var message string
+		switch r.Method {
+		case http.MethodPost:
+			bundle, err := load(ctx)
+			if err != nil {
+				l.ErrorContext(ctx, "Failed to load content bundle.",
+					constant.LogErr, err,
+				)
+				middleware.WriteErrorBody(ctx, http.StatusBadGateway, "Failed to load content bundle.", w)
+				return
+			}
+			err = c.SwapBundle(bundle, options)
+			if err != nil {
+				l.ErrorContext(ctx, "Failed to swap content bundle.",
+					constant.LogErr, err,
+				)
+				middleware.WriteErrorBody(ctx, http.StatusUnprocessableEntity, "Failed to swap content bundle. The current content is still served.", w)
+				return
+			}
+			l.InfoContext(ctx, "Swapped content bundle.")
+			message = "Swapped content."
+		case http.MethodDelete:
+			err := c.Rollback()
+			if err != nil {
+				middleware.WriteErrorBody(ctx, http.StatusConflict, "No previous content to roll back to.", w)
+				return
+			}
+			l.InfoContext(ctx, "Rolled back content.")
+			message = "Rolled back content."
+		default:
+			w.Header().Set(constant.HeaderAllow, "DELETE, POST")
+			middleware.WriteErrorBody(ctx, http.StatusMethodNotAllowed, "Method not allowed.", w)
+			return
+		}
+		w.Header().Set(constant.HeaderCacheControl, "no-store")
+		w.Header().Set(constant.HeaderContentType, "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, message+"\n")
+	})
+}
+
+// Watch polls the content bundle directory dir and swaps it in with SwapBundle after it changes. A change is swapped in
+// once the directory stays the same for one interval, so a partially copied bundle isn't loaded. If dir is a symbolic
+// link, such as one switched to each new release, the directory it points to is loaded. A bundle that fails to load is
+// logged and the current content is kept. It returns a function that stops watching, which can be the Func of a
+// shutdown Hook.
+func (c *ContentSwapper) Watch(dir string, options ContentBundleOptions) func(ctx context.Context) error {
+	if options.Interval <= 0 {
+		options.Interval = DefaultContentWatchInterval
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(options.Interval)
+		defer ticker.Stop()
+		loaded, _, _ := bundleFingerprint(dir)
+		pending := loaded
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, resolved, err := bundleFingerprint(dir)
+			if err != nil {
+				options.Logger.ErrorContext(ctx, "Failed to check content bundle for changes.",
+					constant.LogErr, err,
+				)
+				continue
+			}
+			settled := current == pending
+			pending = current
+			if current == loaded || !settled {
+				continue
+			}
+			loaded = current
+			err = c.SwapBundle(os.DirFS(resolved), options)
+			if err != nil {
+				options.Logger.ErrorContext(ctx, "Failed to swap changed content bundle.",
+					constant.LogErr, err,
+				)
+				continue
+			}
+			options.Logger.InfoContext(ctx, "Swapped changed content bundle.")
+		}
+	}()
+	return func(context.Context) error {
+		cancel()
+		<-done
+		return nil
+	}
+}
+
+// bundleFingerprint hashes the path, size, and modification time of every file in the directory dir points to. It also
+// returns that directory.
+func bundleFingerprint(dir string) (fingerprint [sha256.Size]byte, resolved string, err error) {
+	resolved, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fingerprint, "", fmt.Errorf("failed to resolve content bundle directory: %w", err)
+	}
+	h := sha256.New()
+	_, _ = io.WriteString(h, resolved+"\x00")
+	err = filepath.WalkDir(resolved, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		_, _ = io.WriteString(h, path+"\x00"+strconv.FormatInt(info.Size(), 10)+"\x00"+strconv.FormatInt(info.ModTime().UnixNano(), 10)+"\x00")
+		return nil
+	})
+	if err != nil {
+		return fingerprint, "", fmt.Errorf("failed to walk content bundle directory: %w", err)
+	}
+	copy(fingerprint[:], h.Sum(nil))
+	return fingerprint, resolved, nil
+}
+
+// RequireTemplates returns a validate function for ContentSwapper that fails if any of the named templates is missing.
+func RequireTemplates(names ...string) func(tmpl *template.Template) error {
+	return func(tmpl *template.Template) error {
+		for _, name := range names {
+			if tmpl.Lookup(name) == nil {
+				return fmt.Errorf("template %q is missing", name)
+			}
+		}
+		return nil
+	}
+}
+
+// parseTemplater calls Tmpl, recovering from the panic templaters use to report parse errors.
+func parseTemplater(tmplr templater.Templater) (tmpl *template.Template, err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("failed to parse new templates: %v", r)
+		}
+	}()
+	return tmplr.Tmpl(), nil
+}
@@ -0,0 +1,188 @@
+// Package dbtx abstracts the database transaction started for each request by middleware.CreateAddDBTx, so the
+// transaction-per-request pattern works with pgx and database/sql drivers alike.
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// ErrTxClosed is returned when a transaction is committed or rolled back after it was already committed or rolled
+// back.
+var ErrTxClosed = errors.New("transaction already committed or rolled back")
+
+// Tx is a database transaction.
+type Tx interface {
+	Commit(ctx context.Context) error
+	// Driver returns the transaction of the database driver, such as a pgx.Tx or *sql.Tx. It is stored in the request
+	// context under ctxkey.Tx for handlers to run queries with.
+	Driver() any
+	Rollback(ctx context.Context) error
+}
+
+// Beginner starts database transactions.
+type Beginner interface {
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// FromContext returns the transaction added to the request context by middleware.CreateAddDBTx. If the context only
+// has a pgx transaction under ctxkey.Tx, such as one set by a test, that transaction is returned.
+func FromContext(ctx context.Context) (Tx, bool) {
+	tx, ok := ctx.Value(ctxkey.DBTx).(Tx)
+	if ok {
+		return tx, true
+	}
+	driver, ok := ctxkey.TxFrom(ctx)
+	if ok {
+		return Pgx(driver), true
+	}
+	return nil, false
+}
+
+// Pgx wraps a pgx transaction, such as a savepoint, as a Tx.
+func Pgx(tx pgx.Tx) Tx {
+	return pgxTx{tx: tx}
+}
+
+// PgxBeginner creates a Beginner for pgx, such as from a *pgxpool.Pool's BeginTx method. Transactions are started with
+// the given options unless middleware.CreateTxOptions set other options for the request.
+func PgxBeginner(begin func(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error), options pgx.TxOptions) Beginner {
+	return pgxBeginner{
+		begin:   begin,
+		options: options,
+	}
+}
+
+// SQLBeginner creates a Beginner for database/sql. Transactions are started with the given options, which may be nil.
+func SQLBeginner(db *sql.DB, options *sql.TxOptions) Beginner {
+	return sqlBeginner{
+		db:      db,
+		options: options,
+	}
+}
+
+// StatementTimeout wraps a Postgres Beginner, so every transaction sets the statement_timeout to the time remaining
+// until the deadline of the request context. Queries that are still running when the request times out are then
+// canceled by the server. Transactions of contexts without a deadline are unchanged. It works with the transactions of
+// PgxBeginner and of SQLBeginner with a Postgres driver.
+func StatementTimeout(beginner Beginner) Beginner {
+	return statementTimeout{
+		beginner: beginner,
+	}
+}
+
+type statementTimeout struct {
+	beginner Beginner
+}
+
+func (s statementTimeout) Begin(ctx context.Context) (Tx, error) {
+	tx, err := s.beginner.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return tx, nil
+	}
+	// A statement_timeout of zero disables the timeout, so it is at least one millisecond.
+	timeout := strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10)
+	const query = "SELECT set_config('statement_timeout', $1, true)"
+	switch driver := tx.Driver().(type) {
+	case pgx.Tx:
+		_, err = driver.Exec(ctx, query, timeout)
+	case *sql.Tx:
+		_, err = driver.ExecContext(ctx, query, timeout)
+	default:
+		err = fmt.Errorf("unsupported transaction type %T", driver)
+	}
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, fmt.Errorf("failed to set statement timeout: %w", err)
+	}
+	return tx, nil
+}
+
+type pgxBeginner struct {
+	begin   func(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error)
+	options pgx.TxOptions
+}
+
+func (p pgxBeginner) Begin(ctx context.Context) (Tx, error) {
+	options, ok := ctx.Value(ctxkey.TxOptions).(pgx.TxOptions)
+	if !ok {
+		options = p.options
+	}
+	tx, err := p.begin(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	return Pgx(tx), nil
+}
+
+type pgxTx struct {
+	tx pgx.Tx
+}
+
+func (p pgxTx) Commit(ctx context.Context) error {
+	return pgxErr(p.tx.Commit(ctx))
+}
+
+func (p pgxTx) Driver() any {
+	return p.tx
+}
+
+func (p pgxTx) Rollback(ctx context.Context) error {
+	return pgxErr(p.tx.Rollback(ctx))
+}
+
+func pgxErr(err error) error {
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return fmt.Errorf("%w: %w", ErrTxClosed, err)
+	}
+	return err
+}
+
+type sqlBeginner struct {
+	db      *sql.DB
+	options *sql.TxOptions
+}
+
+func (s sqlBeginner) Begin(ctx context.Context) (Tx, error) {
+	tx, err := s.db.BeginTx(ctx, s.options)
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{tx: tx}, nil
+}
+
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+// Commit commits the transaction. database/sql transactions do not take a context to commit, so ctx is unused.
+func (s sqlTx) Commit(context.Context) error {
+	return sqlErr(s.tx.Commit())
+}
+
+func (s sqlTx) Driver() any {
+	return s.tx
+}
+
+func (s sqlTx) Rollback(context.Context) error {
+	return sqlErr(s.tx.Rollback())
+}
+
+func sqlErr(err error) error {
+	if errors.Is(err, sql.ErrTxDone) {
+		return fmt.Errorf("%w: %w", ErrTxClosed, err)
+	}
+	return err
+}
@@ -0,0 +1,6 @@
+//go:build !httphandle_prod
+
+package httphandle
+
+// devBuild is true unless the binary is built with the httphandle_prod build tag, so development mode is available.
+const devBuild = true
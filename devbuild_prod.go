@@ -0,0 +1,6 @@
+//go:build httphandle_prod
+
+package httphandle
+
+// devBuild is false in binaries built with the httphandle_prod build tag, which compiles out development mode.
+const devBuild = false
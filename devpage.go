@@ -0,0 +1,127 @@
+package httphandle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+var devErrorPageTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<pre>{{.Error}}</pre>
+<h2>Request</h2>
+<p>{{.Method}} {{.URL}}</p>
+<table>
+{{- range $key, $values := .Header}}
+<tr><th>{{$key}}</th><td>{{range $i, $v := $values}}{{if $i}}, {{end}}{{$v}}{{end}}</td></tr>
+{{- end}}
+</table>
+<h2>Logs</h2>
+<pre>{{range .Logs}}{{.}}
+{{end}}</pre>
+{{- if .Stack}}
+<h2>Stack</h2>
+<pre>{{.Stack}}</pre>
+{{- end}}
+</body>
+</html>
+`))
+
+type devErrorPageKey struct{}
+
+// devLogs keeps the log lines of a request for the development error page.
+type devLogs struct {
+	buf bytes.Buffer
+	mux sync.Mutex
+}
+
+func (d *devLogs) Write(p []byte) (int, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.buf.Write(p)
+}
+
+func (d *devLogs) lines() []string {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return strings.Split(strings.TrimSuffix(d.buf.String(), "\n"), "\n")
+}
+
+// devErrorPages renders a debug page with the stack trace, request details, and the request's log lines when the
+// handler panics, including in the goroutine of a RenderBudgeter. If the handler already started its response, the
+// panic is logged and the connection is closed instead. It also lets template failures render the debug page instead of
+// AppSpecific.ErrorTemplate. It must be applied inside the global middleware so the request's logger can be captured.
+func devErrorPages(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logs := &devLogs{}
+		l := ctxkey.LoggerFrom(ctx)
+		l = slog.New(middleware.FanoutHandler{
+			l.Handler(),
+			slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		})
+		ctx = context.WithValue(ctx, ctxkey.Logger, l)
+		ctx = context.WithValue(ctx, devErrorPageKey{}, logs)
+		r = r.WithContext(ctx)
+		sw := middleware.NewStatusWriter(w)
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			stack := debug.Stack()
+			gp, ok := rec.(goroutinePanic)
+			if ok {
+				rec, stack = gp.value, gp.stack
+			}
+			l.ErrorContext(ctx, "Handler panicked.",
+				constant.LogErr, rec,
+			)
+			if sw.Status() != 0 {
+				// The page would be appended to a partial response, so the connection is closed instead.
+				panic(http.ErrAbortHandler)
+			}
+			writeDevErrorPage(w, r, "Panic", fmt.Sprint(rec), stack)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// writeDevErrorPage writes the development error page if the request is handled by devErrorPages. It reports whether
+// the page was written.
+func writeDevErrorPage(w http.ResponseWriter, r *http.Request, title, errMsg string, stack []byte) bool {
+	logs, ok := r.Context().Value(devErrorPageKey{}).(*devLogs)
+	if !ok {
+		return false
+	}
+	w.Header().Set(constant.HeaderCacheControl, "no-store")
+	w.Header().Set(constant.HeaderContentType, constant.ContentTypeHTML+"; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = devErrorPageTemplate.Execute(w, map[string]any{
+		"Error":  errMsg,
+		"Header": r.Header,
+		"Logs":   logs.lines(),
+		"Method": r.Method,
+		"Stack":  string(stack),
+		"Title":  title,
+		"URL":    r.URL.String(),
+	})
+	return true
+}
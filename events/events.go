@@ -0,0 +1,295 @@
+// Package events ingests batched client analytics events through an API handler and forwards them to a Sink.
+package events
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	jt "github.com/MicahParks/jsontype"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+const (
+	// DefaultFlushInterval is the default maximum time events wait before being written to the Sink.
+	DefaultFlushInterval = 5 * time.Second
+	// DefaultFlushSize is the default number of events that triggers a write to the Sink.
+	DefaultFlushSize = 500
+	// DefaultMaxBatch is the default maximum number of events in one request.
+	DefaultMaxBatch = 100
+	// DefaultQueueSize is the default number of batches that can wait for the Sink before requests are rejected.
+	DefaultQueueSize = 1000
+)
+
+var (
+	// ErrClosed is returned by Enqueue after the Ingester is closed.
+	ErrClosed = errors.New("event ingester is closed")
+	// ErrQueueFull is returned by Enqueue when the Sink can't keep up and the queue is full.
+	ErrQueueFull = errors.New("event queue is full")
+)
+
+// Event is a single client analytics event.
+type Event struct {
+	// Key identifies the client that sent the event, as returned by Options.KeyFunc. It is set by the server.
+	Key        string          `json:"-"`
+	Name       string          `json:"name"`
+	Properties json.RawMessage `json:"properties,omitempty"`
+	Timestamp  time.Time       `json:"timestamp"`
+}
+
+// Batch is the request body for the ingestion handler.
+type Batch struct {
+	Events []Event `json:"events"`
+}
+
+func (b Batch) DefaultsAndValidate() (Batch, error) {
+	if len(b.Events) == 0 {
+		return b, fmt.Errorf("%w: at least one event is required", jt.ErrDefaultsAndValidate)
+	}
+	now := time.Now()
+	for i, e := range b.Events {
+		if e.Name == "" {
+			return b, fmt.Errorf("%w: event %d is missing a name", jt.ErrDefaultsAndValidate, i)
+		}
+		if e.Timestamp.IsZero() {
+			b.Events[i].Timestamp = now
+		}
+	}
+	return b, nil
+}
+
+// BatchResult is the response body for the ingestion handler.
+type BatchResult struct {
+	Accepted int `json:"accepted"`
+}
+
+// Schema validates the properties of an event.
+type Schema func(properties json.RawMessage) error
+
+// Sink receives batches of events. Implementations may write to Postgres, Kafka, a file, or anything else.
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+}
+
+// Options are the options for an Ingester.
+type Options struct {
+	FlushInterval time.Duration
+	FlushSize     int
+	// KeyFunc identifies the client of a request for rate limiting. The default uses the remote IP address.
+	KeyFunc  func(r *http.Request) string
+	Logger   *slog.Logger
+	MaxBatch int
+	// MaxEventSize is the maximum size of one event's properties in bytes. Zero means no limit.
+	MaxEventSize int
+	QueueSize    int
+	// RateBurst and RatePerSecond limit the events accepted per key. Zero RatePerSecond means no limit.
+	RateBurst     int
+	RatePerSecond float64
+	// Schemas are the registered event names and their validators. Events with other names are rejected. A nil Schema
+	// accepts any properties.
+	Schemas map[string]Schema
+	Sink    Sink
+}
+
+// Ingester validates events, queues them, and writes them to the Sink in the background.
+type Ingester struct {
+	closed  bool
+	done    chan struct{}
+	limiter *limiter
+	mux     sync.RWMutex
+	options Options
+	queue   chan []Event
+}
+
+// NewIngester creates an Ingester and starts writing to the Sink in the background. Call Close to flush and stop.
+func NewIngester(options Options) (*Ingester, error) {
+	if options.Sink == nil {
+		return nil, errors.New("an event sink is required")
+	}
+	if options.FlushInterval == 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+	if options.FlushSize == 0 {
+		options.FlushSize = DefaultFlushSize
+	}
+	if options.KeyFunc == nil {
+		options.KeyFunc = middleware.RemoteIP
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	if options.MaxBatch == 0 {
+		options.MaxBatch = DefaultMaxBatch
+	}
+	if options.QueueSize == 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+	if options.RateBurst == 0 {
+		options.RateBurst = options.MaxBatch
+	}
+	i := &Ingester{
+		done:    make(chan struct{}),
+		limiter: newLimiter(options.RatePerSecond, options.RateBurst),
+		options: options,
+		queue:   make(chan []Event, options.QueueSize),
+	}
+	go i.run()
+	return i, nil
+}
+
+// Close stops accepting events and writes the queued events to the Sink. It can be used as ServeArgs.ShutdownFunc.
+func (i *Ingester) Close(ctx context.Context) error {
+	i.mux.Lock()
+	if !i.closed {
+		i.closed = true
+		close(i.queue)
+	}
+	i.mux.Unlock()
+	select {
+	case <-i.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush events before context ended: %w", ctx.Err())
+	}
+}
+
+// Enqueue queues events for the Sink without blocking. It returns ErrQueueFull if the Sink can't keep up.
+func (i *Ingester) Enqueue(events []Event) error {
+	i.mux.RLock()
+	defer i.mux.RUnlock()
+	if i.closed {
+		return ErrClosed
+	}
+	select {
+	case i.queue <- events:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Validate checks events against the registered schemas and size limit.
+func (i *Ingester) Validate(events []Event) error {
+	for n, e := range events {
+		schema, ok := i.options.Schemas[e.Name]
+		if !ok {
+			return fmt.Errorf("event %d has unregistered name %q", n, e.Name)
+		}
+		if i.options.MaxEventSize > 0 && len(e.Properties) > i.options.MaxEventSize {
+			return fmt.Errorf("event %d properties exceed %d bytes", n, i.options.MaxEventSize)
+		}
+		if schema == nil {
+			continue
+		}
+		err := schema(e.Properties)
+		if err != nil {
+			return fmt.Errorf("event %d of type %q is invalid: %w", n, e.Name, err)
+		}
+	}
+	return nil
+}
+
+func (i *Ingester) run() {
+	defer close(i.done)
+	ticker := time.NewTicker(i.options.FlushInterval)
+	defer ticker.Stop()
+	var buf []Event
+	for {
+		select {
+		case events, ok := <-i.queue:
+			if !ok {
+				i.flush(buf)
+				return
+			}
+			buf = append(buf, events...)
+			if len(buf) < i.options.FlushSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		i.flush(buf)
+		buf = nil
+	}
+}
+
+func (i *Ingester) flush(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), i.options.FlushInterval)
+	defer cancel()
+	err := i.options.Sink.Write(ctx, events)
+	if err != nil {
+		i.options.Logger.ErrorContext(ctx, "Failed to write events to sink.",
+			constant.LogErr, err,
+			constant.LogCount, len(events),
+		)
+	}
+}
+
+type bucket struct {
+	key    string
+	last   time.Time
+	tokens float64
+}
+
+// limiter is a token bucket per key. The buckets are kept in a list from most to least recently used, so idle buckets
+// are evicted from the back without scanning the rest.
+type limiter struct {
+	buckets map[string]*list.Element
+	burst   float64
+	lru     *list.List
+	mux     sync.Mutex
+	rate    float64
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{
+		buckets: make(map[string]*list.Element),
+		burst:   float64(burst),
+		lru:     list.New(),
+		rate:    rate,
+	}
+}
+
+func (l *limiter) allow(key string, n int) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	// A bucket idle for this long has refilled, so forgetting it doesn't change any result.
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for back := l.lru.Back(); back != nil && now.Sub(back.Value.(*bucket).last) >= refill; back = l.lru.Back() {
+		delete(l.buckets, back.Value.(*bucket).key)
+		l.lru.Remove(back)
+	}
+	e, ok := l.buckets[key]
+	if ok {
+		l.lru.MoveToFront(e)
+	} else {
+		e = l.lru.PushFront(&bucket{
+			key:    key,
+			last:   now,
+			tokens: l.burst,
+		})
+		l.buckets[key] = e
+	}
+	b := e.Value.(*bucket)
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
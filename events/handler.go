@@ -0,0 +1,90 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MicahParks/httphandle"
+	"github.com/MicahParks/httphandle/api"
+	"github.com/MicahParks/httphandle/constant"
+)
+
+// URLPattern is the default URL pattern for the ingestion handler.
+const URLPattern = "/events"
+
+// Handler is an API handler that accepts batches of events and queues them on an Ingester.
+type Handler[A httphandle.AppSpecific] struct {
+	Ingester *Ingester
+	// Pattern is the URL pattern. If empty, URLPattern is used.
+	Pattern string
+}
+
+func (h Handler[A]) ApplyMiddleware(next http.Handler) http.Handler {
+	return next
+}
+
+func (h Handler[A]) Authorize(_ http.ResponseWriter, r *http.Request) (bool, *http.Request) {
+	return true, r
+}
+
+func (h Handler[A]) ContentType() (request, response string) {
+	return constant.ContentTypeJSON, constant.ContentTypeJSON
+}
+
+func (h Handler[A]) HTTPMethod() string {
+	return http.MethodPost
+}
+
+func (h Handler[A]) Initialize(A) error {
+	if h.Ingester == nil {
+		return errors.New("events handler requires an Ingester")
+	}
+	return nil
+}
+
+func (h Handler[A]) Respond(r *http.Request) (code int, body []byte, err error) {
+	batch, l, ctx, code, body, err := api.ExtractJSON[Batch](r)
+	if err != nil {
+		l.InfoContext(ctx, "Failed to extract events.",
+			constant.LogErr, err,
+		)
+		return code, body, nil
+	}
+
+	options := h.Ingester.options
+	if len(batch.Events) > options.MaxBatch {
+		return api.ErrorResponse(ctx, http.StatusRequestEntityTooLarge, fmt.Sprintf("A batch may contain at most %d events.", options.MaxBatch))
+	}
+	err = h.Ingester.Validate(batch.Events)
+	if err != nil {
+		return api.ErrorResponse(ctx, http.StatusUnprocessableEntity, err.Error())
+	}
+	key := options.KeyFunc(r)
+	if !h.Ingester.limiter.allow(key, len(batch.Events)) {
+		return api.ErrorResponse(ctx, http.StatusTooManyRequests, "Event rate limit exceeded.")
+	}
+	for i := range batch.Events {
+		batch.Events[i].Key = key
+	}
+
+	err = h.Ingester.Enqueue(batch.Events)
+	if err != nil {
+		l.WarnContext(ctx, "Failed to queue events.",
+			constant.LogErr, err,
+		)
+		return api.ErrorResponse(ctx, http.StatusServiceUnavailable, "Events are not being accepted right now. Retry later.")
+	}
+
+	result := BatchResult{
+		Accepted: len(batch.Events),
+	}
+	return api.RespondJSON(ctx, http.StatusAccepted, result)
+}
+
+func (h Handler[A]) URLPattern() string {
+	if h.Pattern == "" {
+		return URLPattern
+	}
+	return h.Pattern
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FileSink writes events as JSON lines.
+type FileSink struct {
+	mux sync.Mutex
+	w   io.Writer
+}
+
+// NewFileSink creates a FileSink that writes to w.
+func NewFileSink(w io.Writer) *FileSink {
+	return &FileSink{
+		w: w,
+	}
+}
+
+func (f *FileSink) Write(_ context.Context, events []Event) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	e := json.NewEncoder(f.w)
+	for _, event := range events {
+		line := struct {
+			Event
+			Key string `json:"key"`
+		}{
+			Event: event,
+			Key:   event.Key,
+		}
+		err := e.Encode(line)
+		if err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+	}
+	return nil
+}
+
+// PostgresSink copies events into a table with the columns key (text), name (text), properties (jsonb), and
+// timestamp (timestamptz).
+type PostgresSink struct {
+	Pool  *pgxpool.Pool
+	Table string
+}
+
+func (p PostgresSink) Write(ctx context.Context, events []Event) error {
+	rows := make([][]any, len(events))
+	for i, e := range events {
+		var properties any
+		if len(e.Properties) > 0 {
+			properties = e.Properties
+		}
+		rows[i] = []any{e.Key, e.Name, properties, e.Timestamp}
+	}
+	_, err := p.Pool.CopyFrom(ctx, pgx.Identifier{p.Table}, []string{"key", "name", "properties", "timestamp"}, pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("failed to copy events into Postgres: %w", err)
+	}
+	return nil
+}
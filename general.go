@@ -0,0 +1,40 @@
+package httphandle
+
+import (
+	"net/http"
+
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+// WrapGeneral adapts a plain http.Handler, such as pprof or an existing mux tree, to the General interface so it can
+// be attached with the global middleware. The middleware in mw is applied in the order it is passed in, like
+// middleware.Wrap.
+func WrapGeneral[A AppSpecific](pattern string, h http.Handler, mw ...middleware.Middleware) General[A] {
+	return wrappedGeneral[A]{
+		handler:    h,
+		middleware: mw,
+		pattern:    pattern,
+	}
+}
+
+type wrappedGeneral[A AppSpecific] struct {
+	handler    http.Handler
+	middleware []middleware.Middleware
+	pattern    string
+}
+
+func (g wrappedGeneral[A]) ApplyMiddleware(h http.Handler) http.Handler {
+	return middleware.Wrap(h, g.middleware...)
+}
+
+func (g wrappedGeneral[A]) Initialize(A) error {
+	return nil
+}
+
+func (g wrappedGeneral[A]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.handler.ServeHTTP(w, r)
+}
+
+func (g wrappedGeneral[A]) URLPattern() string {
+	return g.pattern
+}
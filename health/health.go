@@ -0,0 +1,230 @@
+// Package health runs named health checks and serves liveness and readiness endpoints, such as the /healthz and
+// /readyz probes of Kubernetes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+const (
+	// DefaultTimeout is the default time each check has to finish.
+	DefaultTimeout = 5 * time.Second
+	// PatternLiveness is the conventional URL pattern for the liveness handler.
+	PatternLiveness = "GET /healthz"
+	// PatternReadiness is the conventional URL pattern for the readiness handler.
+	PatternReadiness = "GET /readyz"
+	// StatusFail means a check failed.
+	StatusFail = "fail"
+	// StatusOK means a check passed.
+	StatusOK = "ok"
+	// StatusShuttingDown means the server is shutting down and should not receive new traffic.
+	StatusShuttingDown = "shutting down"
+)
+
+// Check reports an unhealthy dependency by returning an error. It should return when ctx is done.
+type Check func(ctx context.Context) error
+
+// Pinger is implemented by *pgxpool.Pool, *pgx.Conn, and other connections that can be pinged.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping creates a Check that pings a connection, such as a Postgres pool.
+func Ping(p Pinger) Check {
+	return func(ctx context.Context) error {
+		err := p.Ping(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to ping: %w", err)
+		}
+		return nil
+	}
+}
+
+// Options are the options for a Checker.
+type Options struct {
+	// ShutdownDelay is how long Shutdown waits after flipping to not-ready, so load balancers stop sending traffic
+	// before the server stops accepting it.
+	ShutdownDelay time.Duration
+	// Timeout is the time each check has to finish. The default is DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Result is the result of a single check.
+type Result struct {
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Status   string        `json:"status"`
+}
+
+// Report is the aggregated result of all checks.
+type Report struct {
+	Checks map[string]Result `json:"checks,omitempty"`
+	Status string            `json:"status"`
+}
+
+// Checker holds named checks and serves the liveness and readiness endpoints. It is safe for concurrent use.
+type Checker struct {
+	checks       map[string]Check
+	mux          sync.RWMutex
+	options      Options
+	shuttingDown bool
+}
+
+// New creates a Checker.
+func New(options Options) *Checker {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	return &Checker{
+		checks:  make(map[string]Check),
+		options: options,
+	}
+}
+
+// Add registers a named check for readiness. A check with the same name is replaced.
+func (c *Checker) Add(name string, check Check) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.checks[name] = check
+}
+
+// Check runs all checks concurrently and aggregates their results. The report fails if any check fails, and is
+// StatusShuttingDown after Shutdown is called.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mux.RLock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	shuttingDown := c.shuttingDown
+	c.mux.RUnlock()
+
+	report := Report{
+		Checks: make(map[string]Result, len(checks)),
+		Status: StatusOK,
+	}
+	if shuttingDown {
+		report.Status = StatusShuttingDown
+		return report
+	}
+
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := c.run(ctx, check)
+			mux.Lock()
+			defer mux.Unlock()
+			report.Checks[name] = res
+			if res.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+// Liveness returns the handler for the liveness endpoint. It responds OK as long as the process can serve requests,
+// without running any checks, so a failing dependency doesn't get the process restarted.
+func (c *Checker) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{
+			Status: StatusOK,
+		})
+	})
+}
+
+// Readiness returns the handler for the readiness endpoint. It runs the checks and responds with the report. The
+// status code is 503 if any check fails or the server is shutting down.
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		report := c.Check(ctx)
+		if report.Status == StatusOK {
+			writeReport(w, http.StatusOK, report)
+			return
+		}
+		l := ctxkey.LoggerFrom(ctx)
+		names := make([]string, 0, len(report.Checks))
+		for name, res := range report.Checks {
+			if res.Status != StatusOK {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		l.WarnContext(ctx, "Not ready.",
+			"checks", names,
+			"status", report.Status,
+		)
+		writeReport(w, http.StatusServiceUnavailable, report)
+	})
+}
+
+// Shutdown flips the readiness endpoint to not-ready, then waits for Options.ShutdownDelay or until ctx is done. It
+// can be used as, or called first in, ServeArgs.ShutdownFunc.
+func (c *Checker) Shutdown(ctx context.Context) error {
+	c.mux.Lock()
+	c.shuttingDown = true
+	c.mux.Unlock()
+	if c.options.ShutdownDelay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(c.options.ShutdownDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("context ended during readiness shutdown delay: %w", ctx.Err())
+	}
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := runRecovered(ctx, check)
+	res := Result{
+		Duration: time.Since(start),
+		Status:   StatusOK,
+	}
+	if err != nil {
+		res.Error = err.Error()
+		res.Status = StatusFail
+	}
+	return res
+}
+
+func runRecovered(ctx context.Context, check Check) (err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("check panicked: %v", r)
+		}
+	}()
+	return check(ctx)
+}
+
+func writeReport(w http.ResponseWriter, code int, report Report) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(constant.HeaderCacheControl, "no-store")
+	w.Header().Set(constant.HeaderContentType, constant.ContentTypeJSON)
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,92 @@
+// Package hherr separates the internal detail of an error from what is sent to the client. API handlers return an
+// *Error from Respond, and the framework logs the internal error with the request's logger, which includes the request
+// UUID, but only serializes the public status code, error code, and message.
+package hherr
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MicahParks/httphandle/api"
+	"github.com/MicahParks/httphandle/constant"
+)
+
+// Error is an error with a public portion, sent to the client, and an internal portion, only logged.
+type Error struct {
+	// Code is the HTTP status code. If it is zero or not a valid status code, 500 is sent.
+	Code int
+	// Err is the internal error. It may be nil.
+	Err error
+	// ErrorCode is the machine-readable error code, such as api.CodeNotFound. If it is empty, api.StatusErrorCode of
+	// Code is sent.
+	ErrorCode string
+	// Message is the public message.
+	Message string
+}
+
+// New creates an Error. A zero or invalid code defaults to 500, and an empty errorCode defaults to api.StatusErrorCode
+// of the code.
+func New(code int, errorCode, message string, err error) *Error {
+	if code < 100 || code > 999 {
+		code = http.StatusInternalServerError
+	}
+	if errorCode == "" {
+		errorCode = api.StatusErrorCode(code)
+	}
+	return &Error{
+		Code:      code,
+		Err:       err,
+		ErrorCode: errorCode,
+		Message:   message,
+	}
+}
+
+// BadRequest creates a 400 Error.
+func BadRequest(message string, err error) *Error {
+	return New(http.StatusBadRequest, api.CodeBadRequest, message, err)
+}
+
+// Conflict creates a 409 Error.
+func Conflict(message string, err error) *Error {
+	return New(http.StatusConflict, api.CodeConflict, message, err)
+}
+
+// Forbidden creates a 403 Error.
+func Forbidden(message string, err error) *Error {
+	return New(http.StatusForbidden, api.CodeForbidden, message, err)
+}
+
+// Internal creates a 500 Error with a generic public message.
+func Internal(err error) *Error {
+	return New(http.StatusInternalServerError, api.CodeInternal, constant.RespInternalServerError, err)
+}
+
+// NotFound creates a 404 Error.
+func NotFound(message string, err error) *Error {
+	return New(http.StatusNotFound, api.CodeNotFound, message, err)
+}
+
+// Unauthorized creates a 401 Error.
+func Unauthorized(message string, err error) *Error {
+	return New(http.StatusUnauthorized, api.CodeUnauthorized, message, err)
+}
+
+// As returns the *Error in err's chain, if any.
+func As(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// Error returns the public message followed by the internal error.
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the internal error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
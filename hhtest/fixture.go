@@ -0,0 +1,127 @@
+package hhtest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/MicahParks/httphandle/dbtx"
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// ContextOptions are the options for NewContext and NewRequest.
+type ContextOptions struct {
+	// Clock, if not nil, is the request's clock for ctxkey.NowFrom, such as the Now method of a Clock.
+	Clock func() time.Time
+	// Identity, if not nil, is added as the authenticated identity.
+	Identity *middleware.Identity
+	// Logger is the request's logger. The default is a logger from NewLogger.
+	Logger *slog.Logger
+	// ReqUUID is the request UUID. The default is a random UUID.
+	ReqUUID uuid.UUID
+	// Tx, if not nil, is added as the request's transaction, as middleware.CreateAddTx does. Use a *FakeTx to check
+	// whether a handler commits.
+	Tx pgx.Tx
+}
+
+// NewContext creates a context with the values the global middleware and transaction middleware add, so the Respond
+// methods of handlers and the api package helpers can be unit tested without the full middleware stack.
+func NewContext(tb testing.TB, ctx context.Context, options ContextOptions) context.Context {
+	tb.Helper()
+	if options.Logger == nil {
+		options.Logger = NewLogger(tb)
+	}
+	if options.ReqUUID == uuid.Nil {
+		options.ReqUUID = uuid.New()
+	}
+	ctx = context.WithValue(ctx, ctxkey.ReqUUID, options.ReqUUID)
+	if options.Clock != nil {
+		ctx = context.WithValue(ctx, ctxkey.Clock, options.Clock)
+	}
+	ctx = context.WithValue(ctx, ctxkey.Logger, options.Logger.With(
+		middleware.FieldKeyReqUUID, options.ReqUUID.String(),
+	))
+	if options.Identity != nil {
+		ctx = middleware.WithIdentity(ctx, *options.Identity)
+	}
+	if options.Tx != nil {
+		tx, err := dbtx.PgxBeginner(func(context.Context, pgx.TxOptions) (pgx.Tx, error) {
+			return options.Tx, nil
+		}, pgx.TxOptions{}).Begin(ctx)
+		if err != nil {
+			tb.Fatalf("Failed to add transaction: %v", err)
+		}
+		ctx = context.WithValue(ctx, ctxkey.Tx, tx.Driver())
+		ctx = context.WithValue(ctx, ctxkey.DBTx, tx)
+	}
+	return ctx
+}
+
+// NewRequest creates a request for unit tests, like httptest.NewRequest, whose context is from NewContext.
+func NewRequest(tb testing.TB, method, target string, body io.Reader, options ContextOptions) *http.Request {
+	tb.Helper()
+	r := httptest.NewRequest(method, target, body)
+	return r.WithContext(NewContext(tb, r.Context(), options))
+}
+
+// FakeTx is a pgx.Tx that records whether it was committed or rolled back. Other methods panic, because they are
+// promoted from the nil embedded pgx.Tx. Embed FakeTx in another type to fake queries.
+type FakeTx struct {
+	pgx.Tx
+
+	// CommitErr is returned by Commit.
+	CommitErr error
+
+	committed  bool
+	mux        sync.Mutex
+	rolledBack bool
+}
+
+// Commit records the commit and returns CommitErr. It returns pgx.ErrTxClosed if the transaction already ended.
+func (f *FakeTx) Commit(context.Context) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.committed || f.rolledBack {
+		return pgx.ErrTxClosed
+	}
+	if f.CommitErr != nil {
+		f.rolledBack = true
+		return f.CommitErr
+	}
+	f.committed = true
+	return nil
+}
+
+// Rollback records the rollback. It returns pgx.ErrTxClosed if the transaction already ended.
+func (f *FakeTx) Rollback(context.Context) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.committed || f.rolledBack {
+		return pgx.ErrTxClosed
+	}
+	f.rolledBack = true
+	return nil
+}
+
+// Committed reports whether the transaction was committed.
+func (f *FakeTx) Committed() bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.committed
+}
+
+// RolledBack reports whether the transaction was rolled back, including by a failed commit.
+func (f *FakeTx) RolledBack() bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.rolledBack
+}
@@ -0,0 +1,138 @@
+// Package hhtest provides helpers for end-to-end tests of httphandle applications.
+package hhtest
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hh "github.com/MicahParks/httphandle"
+	"github.com/MicahParks/httphandle/health"
+)
+
+const (
+	// DefaultReadyTimeout is how long StartServer waits for the readiness checks of its health.Checker to pass.
+	DefaultReadyTimeout = 5 * time.Second
+	// DefaultShutdownTimeout is the shutdown timeout used when ServeArgs.ShutdownTimeout is zero.
+	DefaultShutdownTimeout = 5 * time.Second
+)
+
+// NewLogger creates a logger that writes to the test log at debug level.
+func NewLogger(tb testing.TB) *slog.Logger {
+	return slog.New(slog.NewTextHandler(testWriter{tb: tb}, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+}
+
+// StartServer serves the handler with hh.ServeContext on an ephemeral port of the loopback interface and returns the
+// base URL, such as "http://127.0.0.1:41234", and a shutdown function. ServeArgs.Port and ServeArgs.Listener are
+// ignored. If ServeArgs.Logger is nil, a logger from NewLogger is used. It returns after the ServeArgs.OnReady hooks
+// run. If checker is not nil, its liveness and readiness handlers are served at health.PatternLiveness and
+// health.PatternReadiness, and it also waits up to DefaultReadyTimeout for the readiness checks to pass. The shutdown
+// function shuts the server down like a signal would, including ServeArgs.ShutdownFunc, the in-flight drain, the
+// Supervisor, and ServeArgs.ShutdownHooks. It is also registered with tb.Cleanup, so calling it is optional. It is safe
+// to call more than once.
+func StartServer(tb testing.TB, args hh.ServeArgs, handler http.Handler, checker *health.Checker) (baseURL string, shutdown func()) {
+	tb.Helper()
+	if args.Logger == nil {
+		args.Logger = NewLogger(tb)
+	}
+	if args.ShutdownTimeout == 0 {
+		args.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if checker != nil {
+		mux := http.NewServeMux()
+		mux.Handle(health.PatternLiveness, checker.Liveness())
+		mux.Handle(health.PatternReadiness, checker.Readiness())
+		mux.Handle("/", handler)
+		handler = mux
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("Failed to listen on an ephemeral port: %v", err)
+	}
+	args.Listener = listener
+	baseURL = "http://" + listener.Addr().String()
+	ready := make(chan struct{})
+	args.OnReady = append(append([]hh.Hook{}, args.OnReady...), hh.Hook{
+		Func: func(context.Context) error {
+			close(ready)
+			return nil
+		},
+		Name: "hhtest ready",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- hh.ServeContext(ctx, args, handler)
+	}()
+
+	var once sync.Once
+	var serveErr error
+	shutdown = func() {
+		once.Do(func() {
+			cancel()
+			serveErr = <-done
+			if serveErr != nil {
+				tb.Errorf("Failed to serve test server: %v", serveErr)
+			}
+		})
+	}
+	tb.Cleanup(shutdown)
+
+	select {
+	case <-ready:
+	case err = <-done:
+		once.Do(func() {})
+		cancel()
+		tb.Fatalf("Test server stopped before it was ready: %v", err)
+	}
+	if checker != nil {
+		waitReady(tb, baseURL)
+	}
+	return baseURL, shutdown
+}
+
+// waitReady polls the readiness endpoint until it responds OK.
+func waitReady(tb testing.TB, baseURL string) {
+	tb.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultReadyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+strings.TrimPrefix(health.PatternReadiness, http.MethodGet+" "), nil)
+		if err != nil {
+			tb.Fatalf("Failed to create readiness request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			tb.Fatalf("Test server wasn't ready before %s.", DefaultReadyTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+type testWriter struct {
+	tb testing.TB
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.tb.Log(string(bytes.TrimSuffix(p, []byte("\n"))))
+	return len(p), nil
+}
@@ -0,0 +1,101 @@
+package hhtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hh "github.com/MicahParks/httphandle"
+	"github.com/MicahParks/httphandle/api"
+	"github.com/MicahParks/httphandle/constant"
+)
+
+// Envelope is the JSON envelope of API responses, with the data decoded into T.
+type Envelope[T any] struct {
+	Data     T            `json:"data"`
+	Metadata api.Metadata `json:"metadata"`
+}
+
+// NewServer attaches the handlers in args with the global middleware, as Attach does, and serves them with an
+// httptest.Server. The server is closed by tb.Cleanup.
+func NewServer[A hh.AppSpecific](tb testing.TB, args hh.AttachArgs[A], a A) *httptest.Server {
+	tb.Helper()
+	h, err := hh.Build(args, a)
+	if err != nil {
+		tb.Fatalf("Failed to build handlers: %v", err)
+	}
+	srv := httptest.NewServer(h)
+	tb.Cleanup(srv.Close)
+	return srv
+}
+
+// NewJSONRequest creates a request with the JSON encoded body and the JSON content type. If body is nil, the request
+// has no body.
+func NewJSONRequest(tb testing.TB, method, url string, body any) *http.Request {
+	tb.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			tb.Fatalf("Failed to JSON marshal request body: %v", err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		tb.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set(constant.HeaderContentType, constant.ContentTypeJSON)
+	return req
+}
+
+// Do sends the request with the server's client. The response body is closed by tb.Cleanup.
+func Do(tb testing.TB, srv *httptest.Server, req *http.Request) *http.Response {
+	tb.Helper()
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		tb.Fatalf("Failed to send request: %v", err)
+	}
+	tb.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+	return resp
+}
+
+// AssertStatus fails the test if the response does not have the status code.
+func AssertStatus(tb testing.TB, resp *http.Response, code int) {
+	tb.Helper()
+	if resp.StatusCode != code {
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body = io.NopCloser(bytes.NewReader(b))
+		tb.Fatalf("Expected status code %d, got %d with body %q.", code, resp.StatusCode, b)
+	}
+}
+
+// DecodeEnvelope asserts the response has the status code and a JSON envelope, and decodes it.
+func DecodeEnvelope[T any](tb testing.TB, resp *http.Response, code int) Envelope[T] {
+	tb.Helper()
+	AssertStatus(tb, resp, code)
+	if resp.Header.Get(constant.HeaderContentType) != constant.ContentTypeJSON {
+		tb.Fatalf("Expected content type %q, got %q.", constant.ContentTypeJSON, resp.Header.Get(constant.HeaderContentType))
+	}
+	var e Envelope[T]
+	err := json.NewDecoder(resp.Body).Decode(&e)
+	if err != nil {
+		tb.Fatalf("Failed to JSON decode response envelope: %v", err)
+	}
+	return e
+}
+
+// DecodeError asserts the response has the status code and a JSON error envelope, and returns the error.
+func DecodeError(tb testing.TB, resp *http.Response, code int) api.Error {
+	tb.Helper()
+	e := DecodeEnvelope[api.Error](tb, resp, code)
+	if e.Data.Code != code {
+		tb.Fatalf("Expected error code %d in the body, got %d.", code, e.Data.Code)
+	}
+	return e.Data
+}
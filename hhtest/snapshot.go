@@ -0,0 +1,193 @@
+package hhtest
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	hh "github.com/MicahParks/httphandle"
+)
+
+// DefaultGoldenDir is the directory golden files are stored in when SnapshotOptions.Dir is empty.
+const DefaultGoldenDir = "testdata"
+
+var update = flag.Bool("hhtest.update", false, "Update golden files instead of comparing against them.")
+
+var (
+	timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?`)
+	uuidPattern      = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+)
+
+// Normalizer replaces volatile parts of a snapshot, such as IDs and times, with stable values.
+type Normalizer func(s string) string
+
+// NormalizeTimestamps replaces RFC 3339 style timestamps with a fixed placeholder.
+func NormalizeTimestamps(s string) string {
+	return timestampPattern.ReplaceAllString(s, "TIMESTAMP")
+}
+
+// NormalizeUUIDs replaces UUIDs, such as the request UUID, with a fixed placeholder.
+func NormalizeUUIDs(s string) string {
+	return uuidPattern.ReplaceAllString(s, "00000000-0000-0000-0000-000000000000")
+}
+
+// SeedUUIDs makes random UUIDs, such as request UUIDs, the same sequence for the same seed until the test ends, so
+// snapshots don't need NormalizeUUIDs. It replaces the global source of the uuid package, so tests using it must not
+// run in parallel.
+func SeedUUIDs(tb testing.TB, seed uint64) {
+	tb.Helper()
+	uuid.SetRand(seededReader{
+		rng: rand.New(rand.NewPCG(seed, seed)),
+	})
+	tb.Cleanup(func() {
+		uuid.SetRand(nil)
+	})
+}
+
+// Clock is a fake clock for ctxkey.NowFrom. It starts at a fixed time and advances by a fixed step after each call to
+// Now, so renders that read the time more than once still get the same times every run. Add it to a request with
+// ContextOptions.Clock. It is safe for concurrent use.
+type Clock struct {
+	mux  sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+// NewClock creates a Clock that starts at start and advances by step.
+func NewClock(start time.Time, step time.Duration) *Clock {
+	return &Clock{
+		now:  start,
+		step: step,
+	}
+}
+
+// Now returns the clock's time and advances it.
+func (c *Clock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+type seededReader struct {
+	rng *rand.Rand
+}
+
+func (s seededReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(s.rng.Uint64())
+	}
+	return len(p), nil
+}
+
+// SnapshotOptions are the options for AssertGolden.
+type SnapshotOptions struct {
+	// Dir is the directory of the golden files. The default is DefaultGoldenDir.
+	Dir string
+	// Normalizers are applied in order before comparing. The default is NormalizeUUIDs and NormalizeTimestamps.
+	Normalizers []Normalizer
+	// Update writes the snapshot to the golden file instead of comparing. It is also enabled by the -hhtest.update
+	// test flag.
+	Update bool
+}
+
+// RenderTemplate attaches the handlers in args and serves the request, returning the response code and body. Use it
+// to render a template handler with fixed inputs for AssertGolden, such as a request from NewRequest with a Clock and
+// UUIDs from SeedUUIDs.
+func RenderTemplate[A hh.AppSpecific](tb testing.TB, args hh.AttachArgs[A], a A, r *http.Request) (int, string) {
+	tb.Helper()
+	h, err := hh.Build(args, a)
+	if err != nil {
+		tb.Fatalf("Failed to build handlers: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec.Code, rec.Body.String()
+}
+
+// AssertGolden normalizes got and compares it against the golden file named name+".golden.html". The test fails with
+// a line diff if they differ.
+func AssertGolden(tb testing.TB, name, got string, options SnapshotOptions) {
+	tb.Helper()
+	if options.Dir == "" {
+		options.Dir = DefaultGoldenDir
+	}
+	if options.Normalizers == nil {
+		options.Normalizers = []Normalizer{NormalizeUUIDs, NormalizeTimestamps}
+	}
+	for _, n := range options.Normalizers {
+		got = n(got)
+	}
+
+	path := filepath.Join(options.Dir, name+".golden.html")
+	if options.Update || *update {
+		err := os.MkdirAll(options.Dir, 0o755)
+		if err != nil {
+			tb.Fatalf("Failed to create golden file directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(got), 0o644)
+		if err != nil {
+			tb.Fatalf("Failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatalf("Failed to read golden file %q, run the test with -hhtest.update to create it: %v", path, err)
+	}
+	if string(want) != got {
+		tb.Errorf("Snapshot does not match golden file %q, run the test with -hhtest.update to accept it:\n%s", path, lineDiff(string(want), got))
+	}
+}
+
+// lineDiff returns the lines removed from want with a "-" prefix and the lines added in got with a "+" prefix, with
+// unchanged lines between them prefixed by a space.
+func lineDiff(want, got string) string {
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	sb := &strings.Builder{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			_, _ = fmt.Fprintf(sb, "  %s\n", a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			_, _ = fmt.Fprintf(sb, "- %s\n", a[i])
+			i++
+		default:
+			_, _ = fmt.Fprintf(sb, "+ %s\n", b[j])
+			j++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,295 @@
+// Package httpsig signs responses with HTTP message signatures (RFC 9421) and verifies them on the client. The body is
+// covered through a Content-Digest header (RFC 9530).
+package httpsig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+const (
+	// AlgorithmEd25519 is the RFC 9421 name of the Ed25519 algorithm.
+	AlgorithmEd25519 = "ed25519"
+	// AlgorithmHMACSHA256 is the RFC 9421 name of the HMAC SHA-256 algorithm.
+	AlgorithmHMACSHA256 = "hmac-sha256"
+	// ComponentStatus is the derived component for the response status code.
+	ComponentStatus = "@status"
+	// DefaultLabel is the default signature label.
+	DefaultLabel = "sig1"
+)
+
+// ErrVerify is returned when a response signature or digest doesn't verify.
+var ErrVerify = errors.New("failed to verify HTTP message signature")
+
+// Key signs and verifies signature bases.
+type Key interface {
+	Algorithm() string
+	KeyID() string
+	Sign(base []byte) ([]byte, error)
+	Verify(base, signature []byte) error
+}
+
+// Ed25519Key is an Ed25519 Key. Private is only needed to sign.
+type Ed25519Key struct {
+	ID      string
+	Private ed25519.PrivateKey
+	Public  ed25519.PublicKey
+}
+
+func (k Ed25519Key) Algorithm() string {
+	return AlgorithmEd25519
+}
+
+func (k Ed25519Key) KeyID() string {
+	return k.ID
+}
+
+func (k Ed25519Key) Sign(base []byte) ([]byte, error) {
+	if len(k.Private) != ed25519.PrivateKeySize {
+		return nil, errors.New("an Ed25519 private key is required to sign")
+	}
+	return ed25519.Sign(k.Private, base), nil
+}
+
+func (k Ed25519Key) Verify(base, signature []byte) error {
+	if !ed25519.Verify(k.Public, base, signature) {
+		return ErrVerify
+	}
+	return nil
+}
+
+// HMACKey is a shared secret Key.
+type HMACKey struct {
+	ID     string
+	Secret []byte
+}
+
+func (k HMACKey) Algorithm() string {
+	return AlgorithmHMACSHA256
+}
+
+func (k HMACKey) KeyID() string {
+	return k.ID
+}
+
+func (k HMACKey) Sign(base []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.Secret)
+	mac.Write(base)
+	return mac.Sum(nil), nil
+}
+
+func (k HMACKey) Verify(base, signature []byte) error {
+	expected, _ := k.Sign(base)
+	if !hmac.Equal(expected, signature) {
+		return ErrVerify
+	}
+	return nil
+}
+
+// Options are the options for signing responses.
+type Options struct {
+	// Headers are the response headers covered by the signature, in addition to the status and Content-Digest. Headers
+	// missing from a response are skipped. The default is Content-Type.
+	Headers []string
+	Key     Key
+	// Label is the signature label. The default is DefaultLabel.
+	Label string
+}
+
+// CreateSigner creates a middleware that adds a Content-Digest header and signs the response. The response is buffered
+// so the digest can be computed, so it is not suitable for streaming handlers. It returns an error if Options.Key is
+// nil.
+func CreateSigner(options Options) (middleware.Middleware, error) {
+	if options.Key == nil {
+		return nil, errors.New("a response signing key is required")
+	}
+	if options.Headers == nil {
+		options.Headers = []string{constant.HeaderContentType}
+	}
+	if options.Label == "" {
+		options.Label = DefaultLabel
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			buf := middleware.NewBufferedWriter(w.Header())
+			next.ServeHTTP(buf, r)
+
+			body := buf.Body()
+			header := w.Header()
+			header.Set(constant.HeaderContentDigest, contentDigest(body))
+			components := []string{ComponentStatus, strings.ToLower(constant.HeaderContentDigest)}
+			for _, name := range options.Headers {
+				if len(header.Values(name)) > 0 {
+					components = append(components, strings.ToLower(name))
+				}
+			}
+			params := signatureParams(components, time.Now(), options.Key)
+			base := signatureBase(components, params, buf.Status(), header)
+			signature, err := options.Key.Sign(base)
+			if err != nil {
+				// The digest is of the handler's body, not the error body.
+				header.Del(constant.HeaderContentDigest)
+				middleware.WriteErrorBody(r.Context(), http.StatusInternalServerError, constant.RespInternalServerError, w)
+				return
+			}
+			header.Set(constant.HeaderSignatureInput, options.Label+"="+params)
+			header.Set(constant.HeaderSignature, options.Label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+			header.Del(constant.HeaderContentLength)
+			w.WriteHeader(buf.Status())
+			_, _ = w.Write(body)
+		})
+	}, nil
+}
+
+// VerifyResponse reads the response body and verifies its Content-Digest and the signature with the label. A maxAge
+// greater than zero rejects signatures created longer ago. The body is returned if the response verifies.
+func VerifyResponse(resp *http.Response, key Key, label string, maxAge time.Duration) ([]byte, error) {
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if label == "" {
+		label = DefaultLabel
+	}
+	if resp.Header.Get(constant.HeaderContentDigest) != contentDigest(body) {
+		return nil, fmt.Errorf("%w: content digest does not match body", ErrVerify)
+	}
+
+	params, ok := dictionaryMember(resp.Header.Get(constant.HeaderSignatureInput), label)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing signature input %q", ErrVerify, label)
+	}
+	components, created, keyID, alg, err := parseSignatureParams(params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrVerify, err)
+	}
+	if keyID != key.KeyID() || alg != key.Algorithm() {
+		return nil, fmt.Errorf("%w: signature key %q with algorithm %q does not match", ErrVerify, keyID, alg)
+	}
+	if maxAge > 0 && time.Since(created) > maxAge {
+		return nil, fmt.Errorf("%w: signature is older than %s", ErrVerify, maxAge)
+	}
+	hasDigest := false
+	for _, c := range components {
+		if c == strings.ToLower(constant.HeaderContentDigest) {
+			hasDigest = true
+		}
+	}
+	if !hasDigest {
+		return nil, fmt.Errorf("%w: signature does not cover the content digest", ErrVerify)
+	}
+
+	sigValue, ok := dictionaryMember(resp.Header.Get(constant.HeaderSignature), label)
+	if !ok || len(sigValue) < 2 || sigValue[0] != ':' || sigValue[len(sigValue)-1] != ':' {
+		return nil, fmt.Errorf("%w: missing signature %q", ErrVerify, label)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sigValue[1 : len(sigValue)-1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode signature: %w", ErrVerify, err)
+	}
+	base := signatureBase(components, params, resp.StatusCode, resp.Header)
+	err = key.Verify(base, signature)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func contentDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+func signatureParams(components []string, created time.Time, key Key) string {
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = strconv.Quote(c)
+	}
+	return "(" + strings.Join(quoted, " ") + ");created=" + strconv.FormatInt(created.Unix(), 10) +
+		";keyid=" + strconv.Quote(key.KeyID()) + ";alg=" + strconv.Quote(key.Algorithm())
+}
+
+func signatureBase(components []string, params string, status int, header http.Header) []byte {
+	b := &bytes.Buffer{}
+	for _, c := range components {
+		b.WriteString(strconv.Quote(c))
+		b.WriteString(": ")
+		if c == ComponentStatus {
+			b.WriteString(strconv.Itoa(status))
+		} else {
+			for i, v := range header.Values(c) {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString(strings.TrimSpace(v))
+			}
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(params)
+	return b.Bytes()
+}
+
+// dictionaryMember returns the value of a member of a structured field dictionary. It only handles the members this
+// package writes, whose values don't contain commas outside of the inner list.
+func dictionaryMember(dictionary, label string) (string, bool) {
+	for _, member := range strings.Split(dictionary, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if ok && name == label {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func parseSignatureParams(params string) (components []string, created time.Time, keyID, alg string, err error) {
+	if !strings.HasPrefix(params, "(") {
+		return nil, created, "", "", errors.New("malformed signature input")
+	}
+	end := strings.Index(params, ")")
+	if end == -1 {
+		return nil, created, "", "", errors.New("malformed signature input")
+	}
+	for _, c := range strings.Fields(params[1:end]) {
+		c, err = strconv.Unquote(c)
+		if err != nil {
+			return nil, created, "", "", fmt.Errorf("malformed signature component: %w", err)
+		}
+		components = append(components, c)
+	}
+	for _, param := range strings.Split(params[end+1:], ";") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "created":
+			unix, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, created, "", "", fmt.Errorf("malformed created parameter: %w", err)
+			}
+			created = time.Unix(unix, 0)
+		case "keyid":
+			keyID, _ = strconv.Unquote(value)
+		case "alg":
+			alg, _ = strconv.Unquote(value)
+		}
+	}
+	return components, created, keyID, alg, nil
+}
@@ -0,0 +1,81 @@
+package inspector
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/MicahParks/httphandle/constant"
+)
+
+var pageTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Request inspector</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 6px;text-align:left;vertical-align:top}pre{white-space:pre-wrap;margin:0}</style>
+</head>
+<body>
+{{- if .Record}}{{with .Record}}
+<p><a href="?">All requests</a></p>
+<h1>{{.Method}} {{.URL}}</h1>
+<p>Status {{.Status}} in {{.Duration}} at {{.Start.Format "15:04:05.000"}}</p>
+<h2>Request headers</h2>
+<table>{{range $k, $v := .RequestHeader}}<tr><th>{{$k}}</th><td>{{range $v}}{{.}} {{end}}</td></tr>{{end}}</table>
+<h2>Request body</h2>
+<pre>{{.RequestBody}}</pre>
+<h2>Logs</h2>
+<table>{{range .Logs}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Level}}</td><td>{{.Message}}</td><td>{{.Attrs}}</td></tr>{{end}}</table>
+<h2>SQL queries</h2>
+<table>{{range .Queries}}<tr><td><pre>{{.SQL}}</pre></td><td>{{.Args}}</td><td>{{.Duration}}</td><td>{{.Err}}</td></tr>{{end}}</table>
+<h2>Timings</h2>
+<table>{{range .Timings}}<tr><td>{{.Name}}</td><td>{{.Duration}}</td></tr>{{end}}</table>
+<h2>Response headers</h2>
+<table>{{range $k, $v := .ResponseHeader}}<tr><th>{{$k}}</th><td>{{range $v}}{{.}} {{end}}</td></tr>{{end}}</table>
+<h2>Response body{{if .ResponseTruncated}} (truncated){{end}}</h2>
+<pre>{{.ResponseBody}}</pre>
+{{end}}{{else}}
+<h1>Recent requests</h1>
+<table>
+<thead><tr><th>Time</th><th>Method</th><th>URL</th><th>Status</th><th>Duration</th><th>Queries</th></tr></thead>
+<tbody>
+{{- range .Records}}
+<tr><td>{{.Start.Format "15:04:05.000"}}</td><td>{{.Method}}</td><td><a href="?id={{.ID}}">{{.URL}}</a></td><td>{{.Status}}</td><td>{{.Duration}}</td><td>{{len .Queries}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+type pageData struct {
+	Record  *Record
+	Records []Record
+}
+
+// ServeHTTP shows the recorded requests, or one request if the id query parameter is set.
+func (i *Inspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := pageData{
+		Records: i.Records(),
+	}
+	id := r.URL.Query().Get("id")
+	if id != "" {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid request ID.", http.StatusBadRequest)
+			return
+		}
+		for _, rec := range data.Records {
+			if rec.ID == n {
+				data.Record = &rec
+				break
+			}
+		}
+		if data.Record == nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	w.Header().Set(constant.HeaderContentType, constant.ContentTypeHTML+"; charset=utf-8")
+	w.Header().Set(constant.HeaderCacheControl, "no-store")
+	_ = pageTemplate.Execute(w, data)
+}
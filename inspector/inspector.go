@@ -0,0 +1,289 @@
+// Package inspector keeps recent requests in memory and shows them in the browser for debugging. It records headers,
+// bodies, logs, SQL queries, template render timings, and responses. It is meant for development mode only, because it
+// keeps request and response bodies in memory and shows them to anyone who can reach it.
+package inspector
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+	"github.com/MicahParks/httphandle/middleware/timing"
+)
+
+const (
+	// DefaultCapacity is the default number of requests kept.
+	DefaultCapacity = 100
+	// DefaultMaxBodySize is the default number of bytes kept of each request and response body.
+	DefaultMaxBodySize = 64 * 1024
+)
+
+type ctxKey struct{}
+
+// Options are the options for an Inspector.
+type Options struct {
+	Capacity    int
+	MaxBodySize int
+}
+
+// LogEntry is a log record written while handling a request.
+type LogEntry struct {
+	Attrs   string
+	Level   slog.Level
+	Message string
+	Time    time.Time
+}
+
+// Query is an SQL query run while handling a request.
+type Query struct {
+	Args     []any
+	Duration time.Duration
+	Err      string
+	SQL      string
+}
+
+// Timing is a timing reported through the timing package while handling a request.
+type Timing struct {
+	Duration time.Duration
+	Name     string
+}
+
+// Record is a recorded request.
+type Record struct {
+	Duration          time.Duration
+	ID                uint64
+	Logs              []LogEntry
+	Method            string
+	Queries           []Query
+	RequestBody       string
+	RequestHeader     http.Header
+	ResponseBody      string
+	ResponseHeader    http.Header
+	ResponseTruncated bool
+	Start             time.Time
+	Status            int
+	Timings           []Timing
+	URL               string
+}
+
+// entry guards a Record while its request is handled.
+type entry struct {
+	inspector *Inspector
+	mux       sync.Mutex
+	record    Record
+}
+
+// Inspector records requests in a ring buffer. It implements http.Handler to show them. Attach it with
+// httphandle.WrapGeneral in development mode.
+type Inspector struct {
+	mux     sync.RWMutex
+	nextID  uint64
+	options Options
+	records []*entry
+}
+
+// New creates an Inspector.
+func New(options Options) *Inspector {
+	if options.Capacity <= 0 {
+		options.Capacity = DefaultCapacity
+	}
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultMaxBodySize
+	}
+	return &Inspector{
+		options: options,
+	}
+}
+
+// Middleware records the requests it handles. It must be applied inside the global middleware, so the request's
+// logger can be replaced with one that also writes to the record. Add it to httphandle.AttachArgs.DevMiddleware.
+func (i *Inspector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		e := &entry{
+			inspector: i,
+			record: Record{
+				Method:        r.Method,
+				RequestHeader: r.Header.Clone(),
+				Start:         time.Now(),
+				URL:           r.URL.String(),
+			},
+		}
+		rec := &e.record
+
+		captured, _ := io.ReadAll(io.LimitReader(r.Body, int64(i.options.MaxBodySize)))
+		rec.RequestBody = string(captured)
+		r.Body = readCloser{
+			Reader: io.MultiReader(bytes.NewReader(captured), r.Body),
+			Closer: r.Body,
+		}
+
+		l, ok := ctx.Value(ctxkey.Logger).(*slog.Logger)
+		if ok {
+			ctx = context.WithValue(ctx, ctxkey.Logger, slog.New(middleware.FanoutHandler{
+				l.Handler(),
+				&recordHandler{entry: e},
+			}))
+		}
+		ctx = timing.NewContext(ctx, func(name string, d time.Duration) {
+			e.mux.Lock()
+			defer e.mux.Unlock()
+			rec.Timings = append(rec.Timings, Timing{
+				Duration: d,
+				Name:     name,
+			})
+		})
+		ctx = context.WithValue(ctx, ctxKey{}, e)
+
+		cw := &captureWriter{
+			ResponseWriter: w,
+			limit:          i.options.MaxBodySize,
+		}
+		next.ServeHTTP(cw, r.WithContext(ctx))
+
+		e.mux.Lock()
+		rec.Duration = time.Since(rec.Start)
+		rec.ResponseBody = cw.body.String()
+		rec.ResponseHeader = w.Header().Clone()
+		rec.ResponseTruncated = cw.truncated
+		rec.Status = cw.status
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		e.mux.Unlock()
+		i.add(e)
+	})
+}
+
+// Records returns copies of the recorded requests, newest first.
+func (i *Inspector) Records() []Record {
+	i.mux.RLock()
+	defer i.mux.RUnlock()
+	records := make([]Record, 0, len(i.records))
+	for n := len(i.records) - 1; n >= 0; n-- {
+		records = append(records, i.records[n].snapshot())
+	}
+	return records
+}
+
+func (i *Inspector) add(e *entry) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.nextID++
+	e.mux.Lock()
+	e.record.ID = i.nextID
+	e.mux.Unlock()
+	if len(i.records) == i.options.Capacity {
+		copy(i.records, i.records[1:])
+		i.records = i.records[:len(i.records)-1]
+	}
+	i.records = append(i.records, e)
+}
+
+func (e *entry) snapshot() Record {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	rec := e.record
+	rec.Logs = append([]LogEntry{}, rec.Logs...)
+	rec.Queries = append([]Query{}, rec.Queries...)
+	rec.Timings = append([]Timing{}, rec.Timings...)
+	return rec
+}
+
+// entryFromContext returns the entry of the request in the context if this Inspector records it.
+func (i *Inspector) entryFromContext(ctx context.Context) *entry {
+	e, _ := ctx.Value(ctxKey{}).(*entry)
+	if e == nil || e.inspector != i {
+		return nil
+	}
+	return e
+}
+
+type captureWriter struct {
+	http.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	status    int
+	truncated bool
+}
+
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	remaining := c.limit - c.body.Len()
+	if remaining < len(b) {
+		c.truncated = true
+	}
+	if remaining > 0 {
+		c.body.Write(b[:min(remaining, len(b))])
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// recordHandler writes log records to the request's Record. It is combined with the request's handler by a
+// middleware.FanoutHandler.
+type recordHandler struct {
+	attrs []string
+	entry *entry
+	group string
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := append([]string{}, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, h.group+a.String())
+		return true
+	})
+	h.entry.mux.Lock()
+	defer h.entry.mux.Unlock()
+	h.entry.record.Logs = append(h.entry.record.Logs, LogEntry{
+		Attrs:   strings.Join(attrs, " "),
+		Level:   r.Level,
+		Message: r.Message,
+		Time:    r.Time,
+	})
+	return nil
+}
+
+func (h *recordHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]string{}, h.attrs...)
+	for _, a := range attrs {
+		c.attrs = append(c.attrs, h.group+a.String())
+	}
+	return &c
+}
+
+func (h *recordHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.group = h.group + name + "."
+	return &c
+}
@@ -0,0 +1,61 @@
+package inspector
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	args []any
+	sql  string
+	time time.Time
+}
+
+// Tracer returns a pgx.QueryTracer that adds queries to the record of the request in the query's context, if the
+// Inspector records the request. Add it to postgres.Config.Tracers, or combine it with other tracers with
+// postgres.MultiTracer.
+func (i *Inspector) Tracer() pgx.QueryTracer {
+	return tracer{
+		inspector: i,
+	}
+}
+
+type tracer struct {
+	inspector *Inspector
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t tracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.inspector.entryFromContext(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, queryStartKey{}, queryStart{
+		args: data.Args,
+		sql:  data.SQL,
+		time: time.Now(),
+	})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	e := t.inspector.entryFromContext(ctx)
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if e == nil || !ok {
+		return
+	}
+	q := Query{
+		Args:     start.args,
+		Duration: time.Since(start.time),
+		SQL:      start.sql,
+	}
+	if data.Err != nil {
+		q.Err = data.Err.Error()
+	}
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	e.record.Queries = append(e.record.Queries, q)
+}
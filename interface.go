@@ -3,9 +3,15 @@ package httphandle
 import (
 	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/MicahParks/httphandle/middleware"
 )
 
-// API is an interface for an API handler.
+// API is an interface for an API handler. If Respond returns an *hherr.Error, its internal error is logged and only its
+// public portion is sent.
 type API[A AppSpecific] interface {
 	ApplyMiddleware(h http.Handler) http.Handler
 	Authorize(w http.ResponseWriter, r *http.Request) (authorized bool, modified *http.Request)
@@ -23,6 +29,31 @@ type AppSpecific interface {
 	NotFound(w http.ResponseWriter, r *http.Request)
 }
 
+// Bulkheader is an optional interface for handlers. If implemented, Attach runs the handler in the returned Bulkhead.
+// Return the same Bulkhead from every handler of a route class so they share its slots.
+type Bulkheader interface {
+	Bulkhead() *middleware.Bulkhead
+}
+
+// CachePolicer is an optional interface for handlers. If implemented, Attach adds a Cache-Control header to the
+// handler's responses using the returned options.
+type CachePolicer interface {
+	CachePolicy() middleware.CacheControlOptions
+}
+
+// CORSPolicer is an optional interface for handlers. If implemented, Attach applies CORS middleware to the handler
+// using the returned options.
+type CORSPolicer interface {
+	CORSPolicy() middleware.CORSOptions
+}
+
+// Enveloper is an optional interface for API handlers. If Envelope returns false, the handler's responses created by
+// the api package are sent without the data and metadata envelope, with the request UUID in the
+// constant.HeaderRequestUUID header instead. It overrides AttachArgs.NoEnvelope.
+type Enveloper interface {
+	Envelope() bool
+}
+
 // General is an interface for a general handler.
 type General[A AppSpecific] interface {
 	ApplyMiddleware(h http.Handler) http.Handler
@@ -42,6 +73,58 @@ type Template[A AppSpecific] interface {
 	WrapperTemplateName() string
 }
 
+// GlobalPolicer is an optional interface for handlers. If implemented, Attach passes AttachArgs.MiddlewareOpts to it
+// and applies the global middleware with the returned options. Use it to skip the request timeout for long-lived
+// streams or raise the size limit for uploads. The logger and request UUID are always added.
+type GlobalPolicer interface {
+	GlobalPolicy(options middleware.GlobalOptions) middleware.GlobalOptions
+}
+
+// OuterMiddlewarer is an optional interface for handlers. Attach wraps handlers in this order, outermost first:
+// ApplyOuterMiddleware; the global middleware from middleware.ApplyGlobal; for API handlers, the JSON options and
+// envelope mode; in development mode, the development error pages and AttachArgs.DevMiddleware; the CORS, Bulkhead,
+// Cache-Control, and transaction policies, in that order; then ApplyMiddleware. Middleware from ApplyMiddleware sees
+// the logger and request UUID in the request context. Middleware from ApplyOuterMiddleware runs before them, such as a
+// rate limiter that should reject requests before any other work.
+type OuterMiddlewarer interface {
+	ApplyOuterMiddleware(h http.Handler) http.Handler
+}
+
+// RenderBudgeter is an optional interface for template handlers. If the handler's Respond method and template
+// execution take longer than the budget, the fallback template is rendered instead with the RequestData as its data.
+// The fallback is meant to be lightweight, such as a skeleton page that refreshes itself. It is sent with a 503 status
+// code, and the context of the slow request is canceled.
+type RenderBudgeter interface {
+	RenderBudget() (budget time.Duration, fallbackTemplateName string)
+}
+
+// RouteNamer is an optional interface for handlers. The name identifies the route in RouteTable.Reverse and the
+// "reverse" template function, so paths aren't hardcoded in templates and redirects.
+type RouteNamer interface {
+	RouteName() string
+}
+
+// RequestDataSetter is an optional interface for template data. If the data passed to the inner template implements
+// it, the framework provides the RequestData before executing the template.
+type RequestDataSetter interface {
+	SetRequestData(data RequestData)
+}
+
+// WrapperChain is an optional interface for template handlers that use more than one layer of wrapper templates. The
+// names are ordered from innermost to outermost, such as a section layout followed by the base layout. If implemented,
+// it takes precedence over WrapperTemplateName.
+type WrapperChain interface {
+	WrapperTemplateNames() []string
+}
+
+// TxPolicer is an optional interface for handlers. If implemented, the transaction added by
+// middleware.CreateAddTxOptions in the handler's ApplyMiddleware is started with the returned options instead of the
+// ones given to CreateAddTxOptions. Use it to run GET endpoints in read-only transactions or critical writes with
+// serializable isolation.
+type TxPolicer interface {
+	TxPolicy() pgx.TxOptions
+}
+
 type WrapperData interface {
 	SetResult(result TemplateDataResult)
 }
@@ -0,0 +1,272 @@
+// Package journal persists selected mutating requests before they are processed, so requests interrupted by a crash
+// can be found and retried when the process starts again. Entries are encrypted at rest with AES-GCM.
+package journal
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+const entryExtension = ".journal"
+
+// Entry is a journaled request.
+type Entry struct {
+	Body     []byte      `json:"body"`
+	Header   http.Header `json:"header"`
+	ID       uuid.UUID   `json:"id"`
+	Method   string      `json:"method"`
+	Received time.Time   `json:"received"`
+	URL      string      `json:"url"`
+}
+
+// Request rebuilds the journaled request.
+func (e Entry) Request(ctx context.Context) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, e.Method, e.URL, bytes.NewReader(e.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request from journal entry: %w", err)
+	}
+	r.Header = e.Header.Clone()
+	return r, nil
+}
+
+// Journal stores entries as encrypted files in a directory. An entry is removed when its request completes.
+type Journal struct {
+	aead cipher.AEAD
+	dir  string
+}
+
+// Open opens the journal in dir, creating the directory if needed. The key must be 16, 24, or 32 bytes for AES-128,
+// AES-192, or AES-256.
+func Open(dir string, key []byte) (*Journal, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal AEAD: %w", err)
+	}
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	return &Journal{
+		aead: aead,
+		dir:  dir,
+	}, nil
+}
+
+// Middleware journals the request before calling next and removes the entry after next returns without panicking and
+// with a response code below 500, the same rule as Replay, so a request that failed partway through can be retried. If
+// the request can't be journaled, it responds with 503 so the client retries instead of the request silently vanishing.
+// It must be applied inside the global middleware, which limits the body size.
+func (j *Journal) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		l := ctxkey.LoggerFrom(ctx)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			middleware.WriteReadBodyError(ctx, err, w)
+			return
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		entry := Entry{
+			Body:     body,
+			Header:   r.Header.Clone(),
+			ID:       uuid.New(),
+			Method:   r.Method,
+			Received: time.Now(),
+			URL:      r.URL.String(),
+		}
+		err = j.Write(entry)
+		if err != nil {
+			l.ErrorContext(ctx, "Failed to journal request.",
+				constant.LogErr, err,
+			)
+			middleware.WriteErrorBody(ctx, http.StatusServiceUnavailable, "Failed to journal request.", w)
+			return
+		}
+
+		sw := middleware.NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+		if sw.Status() >= http.StatusInternalServerError {
+			l.WarnContext(ctx, "Keeping failed request in journal.",
+				constant.LogRespCode, sw.Status(),
+			)
+			return
+		}
+
+		err = j.Remove(entry.ID)
+		if err != nil {
+			l.ErrorContext(ctx, "Failed to remove completed request from journal.",
+				constant.LogErr, err,
+			)
+		}
+	})
+}
+
+// Write durably stores the entry.
+func (j *Journal) Write(entry Entry) error {
+	plain, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to JSON marshal journal entry: %w", err)
+	}
+	nonce := make([]byte, j.aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry nonce: %w", err)
+	}
+	sealed := j.aead.Seal(nonce, nonce, plain, entry.ID[:])
+
+	path := j.path(entry.ID)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry file: %w", err)
+	}
+	_, err = f.Write(sealed)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err != nil || closeErr != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write journal entry file: %w", errors.Join(err, closeErr))
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("failed to commit journal entry file: %w", err)
+	}
+	// The rename is only durable once the directory is synced.
+	dir, err := os.Open(j.dir)
+	if err != nil {
+		return fmt.Errorf("failed to open journal directory: %w", err)
+	}
+	err = dir.Sync()
+	closeErr = dir.Close()
+	if err != nil || closeErr != nil {
+		return fmt.Errorf("failed to sync journal directory: %w", errors.Join(err, closeErr))
+	}
+	return nil
+}
+
+// Remove removes a completed entry.
+func (j *Journal) Remove(id uuid.UUID) error {
+	err := os.Remove(j.path(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove journal entry file: %w", err)
+	}
+	return nil
+}
+
+// Incomplete returns the entries whose requests didn't complete, oldest first. Call it at startup, before serving, to
+// report or retry requests interrupted by a crash.
+func (j *Journal) Incomplete() ([]Entry, error) {
+	dirEntries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory: %w", err)
+	}
+	var entries []Entry
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || !strings.HasSuffix(name, entryExtension) {
+			continue
+		}
+		id, err := uuid.Parse(strings.TrimSuffix(name, entryExtension))
+		if err != nil {
+			continue
+		}
+		sealed, err := os.ReadFile(filepath.Join(j.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal entry file %q: %w", name, err)
+		}
+		nonceSize := j.aead.NonceSize()
+		if len(sealed) < nonceSize {
+			return nil, fmt.Errorf("journal entry file %q is truncated", name)
+		}
+		plain, err := j.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], id[:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt journal entry file %q: %w", name, err)
+		}
+		var entry Entry
+		err = json.Unmarshal(plain, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to JSON unmarshal journal entry file %q: %w", name, err)
+		}
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return a.Received.Compare(b.Received)
+	})
+	return entries, nil
+}
+
+// Replay serves the entry's request to the handler, which should include the global middleware, and removes the entry
+// if the response code is below 500. It returns the response code.
+func (j *Journal) Replay(ctx context.Context, entry Entry, handler http.Handler) (int, error) {
+	r, err := entry.Request(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rec := &statusRecorder{
+		header: make(http.Header),
+	}
+	handler.ServeHTTP(rec, r)
+	code := rec.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	if code >= http.StatusInternalServerError {
+		return code, nil
+	}
+	return code, j.Remove(entry.ID)
+}
+
+func (j *Journal) path(id uuid.UUID) string {
+	return filepath.Join(j.dir, id.String()+entryExtension)
+}
+
+// statusRecorder is an http.ResponseWriter for Replay that keeps the response code and discards the body.
+type statusRecorder struct {
+	code   int
+	header http.Header
+}
+
+func (s *statusRecorder) Header() http.Header {
+	return s.header
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+}
@@ -0,0 +1,43 @@
+package httphandle
+
+import (
+	"context"
+	"time"
+)
+
+// Hook is a named function run at a point in the application's lifecycle.
+type Hook struct {
+	Func func(ctx context.Context) error
+	Name string
+	// Timeout, if positive, limits the hook to this long. The hook is also limited by the context it runs in, such as
+	// the shutdown timeout.
+	Timeout time.Duration
+}
+
+// ConfigHook is a named function run by Setup after the configuration is loaded. Conf is the configuration type passed
+// to Setup.
+type ConfigHook struct {
+	Func func(ctx context.Context, conf any) error
+	Name string
+	// Timeout, if positive, limits the hook to this long.
+	Timeout time.Duration
+}
+
+func runHook(ctx context.Context, hook Hook) error {
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+	return hook.Func(ctx)
+}
+
+func runConfigHook(ctx context.Context, hook ConfigHook, conf any) error {
+	return runHook(ctx, Hook{
+		Func: func(ctx context.Context) error {
+			return hook.Func(ctx, conf)
+		},
+		Name:    hook.Name,
+		Timeout: hook.Timeout,
+	})
+}
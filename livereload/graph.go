@@ -0,0 +1,89 @@
+package livereload
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+)
+
+var (
+	defineRegexp    = regexp.MustCompile(`\{\{-?\s*(?:define|block)\s+"([^"]+)"`)
+	referenceRegexp = regexp.MustCompile(`\{\{-?\s*(?:template|block)\s+"([^"]+)"`)
+)
+
+// Graph is the dependency graph of a template tree at the file level. A file depends on another file if it references
+// a template the other file defines.
+type Graph struct {
+	dependents map[string][]string
+	names      map[string][]string
+}
+
+// ParseGraph reads the template files matching the glob pattern and builds their dependency graph.
+func ParseGraph(fsys fs.FS, pattern string) (Graph, error) {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return Graph{}, fmt.Errorf("failed to glob template files: %w", err)
+	}
+
+	g := Graph{
+		dependents: make(map[string][]string),
+		names:      make(map[string][]string, len(files)),
+	}
+	definedBy := make(map[string]string)
+	references := make(map[string][]string, len(files))
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return Graph{}, fmt.Errorf("failed to read template file %q: %w", file, err)
+		}
+		// html/template names each file's template by its base name.
+		names := []string{path.Base(file)}
+		for _, match := range defineRegexp.FindAllSubmatch(b, -1) {
+			names = append(names, string(match[1]))
+		}
+		for _, name := range names {
+			definedBy[name] = file
+		}
+		g.names[file] = names
+		for _, match := range referenceRegexp.FindAllSubmatch(b, -1) {
+			references[file] = append(references[file], string(match[1]))
+		}
+	}
+
+	for file, refs := range references {
+		for _, ref := range refs {
+			dependency, ok := definedBy[ref]
+			if !ok || dependency == file || slices.Contains(g.dependents[dependency], file) {
+				continue
+			}
+			g.dependents[dependency] = append(g.dependents[dependency], file)
+		}
+	}
+
+	return g, nil
+}
+
+// Affected returns the names of every template defined in the changed files or in files that transitively depend on
+// them.
+func (g Graph) Affected(changed []string) []string {
+	seen := make(map[string]bool)
+	queue := slices.Clone(changed)
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		queue = append(queue, g.dependents[file]...)
+	}
+
+	var names []string
+	for file := range seen {
+		names = append(names, g.names[file]...)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,319 @@
+// Package livereload watches directories in development mode and tells connected browsers to reload when files change.
+package livereload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+const (
+	// DefaultInterval is the default interval for polling the watched directories.
+	DefaultInterval = 500 * time.Millisecond
+	// EventFailed is the server-sent event name for a failed validation.
+	EventFailed = "failed"
+	// EventReload is the server-sent event name for a reload signal.
+	EventReload = "reload"
+	// Path is the URL path of the server-sent events endpoint.
+	Path = "/_livereload"
+)
+
+// Script returns the JavaScript injected into HTML responses to connect to the server-sent events endpoint. The page
+// reloads when a reload event names one of the given template names, or when the event names no templates. If no
+// template names are given, the page reloads on every reload event.
+func Script(pages ...string) string {
+	p, _ := json.Marshal(pages)
+	return `<script>(function(){` +
+		`var p=` + string(p) + `||[];` +
+		`var s=new EventSource("` + Path + `");` +
+		`s.addEventListener("` + EventReload + `",function(e){var c=e.data?JSON.parse(e.data):[];` +
+		`if(!c.length||!p.length||c.some(function(n){return p.indexOf(n)>=0;})){location.reload();}});` +
+		`s.addEventListener("` + EventFailed + `",function(e){console.error(e.data);` +
+		`var d=document.getElementById("_livereload");if(!d){d=document.createElement("pre");d.id="_livereload";` +
+		`d.style.cssText="position:fixed;left:0;right:0;bottom:0;margin:0;padding:1em;z-index:2147483647;background:#300;color:#fcc;white-space:pre-wrap;";` +
+		`document.body.appendChild(d);}d.textContent=e.data;});` +
+		`})();</script>`
+}
+
+// Options are the options for a Reloader.
+type Options struct {
+	Dirs     []string
+	Interval time.Duration
+	Logger   *slog.Logger
+	// TemplatesDir and TemplatesPattern locate the template files. If set, a change that only touches templates
+	// reloads just the pages that use the changed templates, according to the template dependency Graph.
+	TemplatesDir     string
+	TemplatesPattern string
+	// Validate is called after a change is detected. If it returns an error, the error is logged and sent to browsers
+	// instead of a reload signal. It is typically used to parse templates.
+	Validate func() error
+}
+
+// Reloader polls directories for changes and notifies browsers connected to its server-sent events endpoint.
+type Reloader struct {
+	cancel  context.CancelFunc
+	clients map[chan event]struct{}
+	done    chan struct{}
+	graph   Graph
+	mux     sync.Mutex
+	options Options
+}
+
+type event struct {
+	data string
+	name string
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// New creates a Reloader and starts polling the directories in the background. Call Close to stop polling.
+func New(options Options) *Reloader {
+	if options.Interval == 0 {
+		options.Interval = DefaultInterval
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reloader{
+		cancel:  cancel,
+		clients: make(map[chan event]struct{}),
+		done:    make(chan struct{}),
+		options: options,
+	}
+	if options.TemplatesDir != "" {
+		r.graph, _ = ParseGraph(os.DirFS(options.TemplatesDir), options.TemplatesPattern)
+	}
+	go r.poll(ctx)
+	return r
+}
+
+// Close stops polling and disconnects all browsers.
+func (r *Reloader) Close() {
+	r.cancel()
+	<-r.done
+}
+
+// InjectScript creates a middleware that adds the Script for the given template names to the end of HTML response
+// bodies. The whole response is buffered, so it is only meant for development.
+func (r *Reloader) InjectScript(pages ...string) middleware.Middleware {
+	script := Script(pages...)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			buf := middleware.NewBufferedWriter(w.Header())
+			next.ServeHTTP(buf, req)
+			injectScript(w, buf, script)
+		})
+	}
+}
+
+// ServeHTTP implements http.Handler. It streams server-sent events to the browser until the request is done.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported.", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan event, 1)
+	r.mux.Lock()
+	r.clients[ch] = struct{}{}
+	r.mux.Unlock()
+	defer func() {
+		r.mux.Lock()
+		delete(r.clients, ch)
+		r.mux.Unlock()
+	}()
+
+	w.Header().Set(constant.HeaderCacheControl, "no-cache")
+	w.Header().Set(constant.HeaderContentType, constant.ContentTypeEventStream)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-r.done:
+			return
+		case e := <-ch:
+			_, err := w.Write(formatEvent(e))
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (r *Reloader) broadcast(e event) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for ch := range r.clients {
+		select {
+		case ch <- e:
+		default:
+			// The browser already has a pending event.
+		}
+	}
+}
+
+func (r *Reloader) poll(ctx context.Context) {
+	defer close(r.done)
+	previous := r.snapshot()
+	ticker := time.NewTicker(r.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := r.snapshot()
+		changed := diff(previous, current)
+		previous = current
+		if len(changed) == 0 {
+			continue
+		}
+		r.options.Logger.DebugContext(ctx, "Detected file changes.",
+			constant.LogFiles, changed,
+		)
+		if r.options.Validate != nil {
+			err := r.options.Validate()
+			if err != nil {
+				r.options.Logger.ErrorContext(ctx, "Failed to validate changed files.",
+					constant.LogErr, err,
+				)
+				r.broadcast(event{
+					data: err.Error(),
+					name: EventFailed,
+				})
+				continue
+			}
+		}
+		r.broadcast(event{
+			data: r.affected(changed),
+			name: EventReload,
+		})
+	}
+}
+
+// affected returns the JSON encoded names of the templates affected by the changed files. It returns an empty string
+// if every page should reload.
+func (r *Reloader) affected(changed []string) string {
+	if r.options.TemplatesDir == "" {
+		return ""
+	}
+	files := make([]string, 0, len(changed))
+	for _, path := range changed {
+		rel, err := filepath.Rel(r.options.TemplatesDir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return ""
+		}
+		files = append(files, filepath.ToSlash(rel))
+	}
+
+	// Use both graphs so that templates which were moved or removed are still reported.
+	names := r.graph.Affected(files)
+	graph, err := ParseGraph(os.DirFS(r.options.TemplatesDir), r.options.TemplatesPattern)
+	if err == nil {
+		names = append(names, graph.Affected(files)...)
+		r.graph = graph
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	slices.Sort(names)
+	data, err := json.Marshal(slices.Compact(names))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (r *Reloader) snapshot() map[string]fileState {
+	files := make(map[string]fileState)
+	for _, dir := range r.options.Dirs {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			files[path] = fileState{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+func diff(previous, current map[string]fileState) []string {
+	var changed []string
+	for path, state := range current {
+		old, ok := previous[path]
+		if !ok || old != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range previous {
+		_, ok := current[path]
+		if !ok {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
+
+func formatEvent(e event) []byte {
+	var b bytes.Buffer
+	_, _ = fmt.Fprintf(&b, "event: %s\n", e.name)
+	for _, line := range strings.Split(e.data, "\n") {
+		_, _ = fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// injectScript writes the buffered response to w with the script added before the closing body tag of an HTML body.
+func injectScript(w http.ResponseWriter, buf *middleware.BufferedWriter, script string) {
+	body := buf.Body()
+	contentType := w.Header().Get(constant.HeaderContentType)
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	if strings.HasPrefix(contentType, constant.ContentTypeHTML) {
+		i := bytes.LastIndex(body, []byte("</body>"))
+		if i == -1 {
+			i = len(body)
+		}
+		injected := make([]byte, 0, len(body)+len(script))
+		injected = append(injected, body[:i]...)
+		injected = append(injected, script...)
+		injected = append(injected, body[i:]...)
+		body = injected
+		w.Header().Del(constant.HeaderContentLength)
+	}
+	w.WriteHeader(buf.Status())
+	_, _ = w.Write(body)
+}
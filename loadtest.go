@@ -0,0 +1,91 @@
+package httphandle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/MicahParks/httphandle/constant"
+)
+
+// LoadTargetOptions are the options for RouteTable.WriteLoadTargets.
+type LoadTargetOptions struct {
+	// BaseURL is prepended to every path, such as "https://staging.example.com".
+	BaseURL string
+	// Bodies are example request bodies, keyed by route name or by "METHOD pattern".
+	Bodies map[string][]byte
+	// Header, if not nil, returns extra headers for a route, such as an Authorization header with a fresh token.
+	Header func(route Route) http.Header
+	// Params are the wildcard values, keyed by route name or by "METHOD pattern". Routes with wildcards and no params
+	// are skipped.
+	Params map[string]map[string]string
+}
+
+// LoadTarget is a vegeta JSON target.
+type LoadTarget struct {
+	Body   []byte      `json:"body,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+}
+
+// LoadTargets returns a load test target for every API, general, template, and static route.
+func (t *RouteTable) LoadTargets(options LoadTargetOptions) []LoadTarget {
+	var targets []LoadTarget
+	for _, route := range t.Routes() {
+		switch route.Type {
+		case RouteTypeLiveReload, RouteTypePreflight:
+			continue
+		}
+		method := route.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		key := method + " " + route.Pattern
+		params := options.Params[route.Name]
+		if params == nil {
+			params = options.Params[key]
+		}
+		path, err := fillPattern(strings.TrimSuffix(route.Pattern, "{$}"), params)
+		if err != nil {
+			continue
+		}
+		target := LoadTarget{
+			Body:   options.Bodies[route.Name],
+			Header: http.Header{},
+			Method: method,
+			URL:    options.BaseURL + path,
+		}
+		if target.Body == nil {
+			target.Body = options.Bodies[key]
+		}
+		if route.RequestContentType != "" && target.Body != nil {
+			target.Header.Set(constant.HeaderContentType, route.RequestContentType)
+		}
+		if options.Header != nil {
+			for k, v := range options.Header(route) {
+				target.Header[k] = v
+			}
+		}
+		if len(target.Header) == 0 {
+			target.Header = nil
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// WriteLoadTargets writes the targets from LoadTargets in vegeta's JSON format, one per line, for use with
+// "vegeta attack -format=json".
+func (t *RouteTable) WriteLoadTargets(w io.Writer, options LoadTargetOptions) error {
+	enc := json.NewEncoder(w)
+	for _, target := range t.LoadTargets(options) {
+		err := enc.Encode(target)
+		if err != nil {
+			return fmt.Errorf("failed to write load target for %s %s: %w", target.Method, target.URL, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package httphandle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	jt "github.com/MicahParks/jsontype"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// LevelHandler returns an admin handler for a log level. GET responds with the level, such as "INFO". PUT and POST set
+// it from the request body, such as "debug" or "warn+2". Attach it with WrapGeneral behind authentication, such as
+// middleware.CreateBasicAuth.
+func LevelHandler(level *slog.LevelVar) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost, http.MethodPut:
+			ctx := r.Context()
+			l := ctxkey.LoggerFrom(ctx)
+			b, err := io.ReadAll(io.LimitReader(r.Body, 64))
+			if err != nil {
+				middleware.WriteErrorBody(ctx, http.StatusBadRequest, "Failed to read log level.", w)
+				return
+			}
+			var next slog.Level
+			err = next.UnmarshalText(bytes.TrimSpace(b))
+			if err != nil {
+				middleware.WriteErrorBody(ctx, http.StatusBadRequest, "Unknown log level.", w)
+				return
+			}
+			l.InfoContext(ctx, "Changing log level.",
+				"from", level.Level(),
+				"to", next,
+			)
+			level.Set(next)
+		default:
+			w.Header().Set(constant.HeaderAllow, "GET, HEAD, POST, PUT")
+			middleware.WriteErrorBody(r.Context(), http.StatusMethodNotAllowed, "Method not allowed.", w)
+			return
+		}
+		w.Header().Set(constant.HeaderCacheControl, "no-store")
+		w.Header().Set(constant.HeaderContentType, "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, level.Level().String()+"\n")
+	})
+}
+
+// reloadLevelOnSIGHUP re-reads the configuration on SIGHUP and sets level from its LevelDecider. It returns a function
+// that stops it.
+func reloadLevelOnSIGHUP[C jt.Defaulter[C]](options ConfigOptions, level *slog.LevelVar, devMode bool, logger *slog.Logger) func(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-hup:
+			}
+			conf, _, err := readConfig[C](options)
+			if err != nil {
+				logger.Error("Failed to reload configuration for log level.",
+					constant.LogErr, err,
+				)
+				continue
+			}
+			next := logLevel(conf, devMode)
+			logger.Info("Reloaded log level.",
+				"from", level.Level(),
+				"to", next,
+			)
+			level.Set(next)
+		}
+	}()
+	return func(context.Context) error {
+		signal.Stop(hup)
+		close(done)
+		return nil
+	}
+}
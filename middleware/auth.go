@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// BasicAuthOptions are the options for the basic authentication middleware.
+type BasicAuthOptions struct {
+	// Realm is sent to the client in the WWW-Authenticate header.
+	Realm string
+	// Roles maps usernames to the roles of their Identity.
+	Roles map[string][]string
+	// Users maps usernames to passwords.
+	Users map[string]string
+}
+
+// CreateBasicAuth creates a middleware that requires HTTP basic authentication. Requests without valid credentials get
+// a 401. Credentials are compared in constant time. Only use it over HTTPS, because the password is sent in the clear.
+// Authenticated requests get an Identity with the username as the subject. It must be applied inside the global
+// middleware.
+func CreateBasicAuth(options BasicAuthOptions) Middleware {
+	users := make(map[string][sha256.Size]byte, len(options.Users))
+	for user, password := range options.Users {
+		users[user] = sha256.Sum256([]byte(password))
+	}
+	challenge := "Basic realm=" + strconv.Quote(options.Realm) + `, charset="UTF-8"`
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := r.BasicAuth()
+			if ok {
+				want, found := users[user]
+				got := sha256.Sum256([]byte(password))
+				if found && subtle.ConstantTimeCompare(want[:], got[:]) == 1 {
+					ctx := WithIdentity(r.Context(), Identity{
+						Roles:   options.Roles[user],
+						Subject: user,
+					})
+					r = r.WithContext(ctx)
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			w.Header().Set(constant.HeaderWWWAuthenticate, challenge)
+			WriteErrorBody(r.Context(), http.StatusUnauthorized, "Authentication required.", w)
+		})
+	}
+}
+
+// RemoteIP returns the IP address of the connection, without the port. It is not the client's address behind a
+// reverse proxy.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// CreateIPFilter creates a middleware that only allows requests from the given networks, such as
+// netip.MustParsePrefix("127.0.0.1/32"). Other requests get a 403. It uses the address of the connection, so behind a
+// reverse proxy every request comes from the proxy. It must be applied inside the global middleware.
+func CreateIPFilter(allowed ...netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			addr, err := netip.ParseAddr(RemoteIP(r))
+			if err == nil {
+				addr = addr.Unmap()
+				for _, prefix := range allowed {
+					if prefix.Contains(addr) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			l := ctxkey.LoggerFrom(ctx)
+			l.InfoContext(ctx, "Request from address outside IP filter.",
+				"remoteAddr", r.RemoteAddr,
+			)
+			WriteErrorBody(ctx, http.StatusForbidden, "Forbidden.", w)
+		})
+	}
+}
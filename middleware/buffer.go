@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// BufferedWriter is an http.ResponseWriter that holds the response in memory, so it can be inspected, changed, or
+// discarded before it is copied to the real writer. Like a real writer, only the first status code is kept.
+type BufferedWriter struct {
+	body   bytes.Buffer
+	header http.Header
+	status int
+}
+
+// NewBufferedWriter creates a BufferedWriter. Its header is the given header, so handlers set the real writer's header
+// directly, or a new header if nil.
+func NewBufferedWriter(header http.Header) *BufferedWriter {
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &BufferedWriter{
+		header: header,
+	}
+}
+
+// Body returns the body written so far.
+func (b *BufferedWriter) Body() []byte {
+	return b.body.Bytes()
+}
+
+// CopyTo writes the buffered header, status code, and body to w.
+func (b *BufferedWriter) CopyTo(w http.ResponseWriter) {
+	header := w.Header()
+	for key, values := range b.header {
+		header[key] = values
+	}
+	w.WriteHeader(b.Status())
+	_, _ = w.Write(b.body.Bytes())
+}
+
+func (b *BufferedWriter) Header() http.Header {
+	return b.header
+}
+
+// Status returns the status code written, or http.StatusOK if none was.
+func (b *BufferedWriter) Status() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+func (b *BufferedWriter) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *BufferedWriter) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// BulkheadOptions are the options for a Bulkhead.
+type BulkheadOptions struct {
+	// MaxConcurrent is the number of requests handled at once. It must be greater than zero.
+	MaxConcurrent int
+	// MaxQueue is the number of requests that can wait for a free slot. Requests beyond it are rejected right away.
+	MaxQueue int
+	// Name identifies the bulkhead in logs.
+	Name string
+	// QueueTimeout is the longest a request waits for a free slot. Zero waits until the request context is done.
+	QueueTimeout time.Duration
+}
+
+// BulkheadStats are the counters of a Bulkhead.
+type BulkheadStats struct {
+	Active    int64  `json:"active"`
+	Completed int64  `json:"completed"`
+	Name      string `json:"name"`
+	Panics    int64  `json:"panics"`
+	Queued    int64  `json:"queued"`
+	Rejected  int64  `json:"rejected"`
+}
+
+// Bulkhead bounds the concurrency of a class of routes and recovers their panics, so a pathological handler exhausts
+// only its own slots instead of the whole server. Share one Bulkhead between the routes of a class. It can't bound the
+// memory a handler allocates.
+type Bulkhead struct {
+	active    atomic.Int64
+	completed atomic.Int64
+	options   BulkheadOptions
+	panics    atomic.Int64
+	queued    atomic.Int64
+	rejected  atomic.Int64
+	slots     chan struct{}
+}
+
+// NewBulkhead creates a Bulkhead.
+func NewBulkhead(options BulkheadOptions) (*Bulkhead, error) {
+	if options.MaxConcurrent <= 0 {
+		return nil, fmt.Errorf("bulkhead %q must allow at least one concurrent request", options.Name)
+	}
+	return &Bulkhead{
+		options: options,
+		slots:   make(chan struct{}, options.MaxConcurrent),
+	}, nil
+}
+
+// Middleware runs requests in the Bulkhead. Requests that can't get a slot get a 503 and panics get a 500. It must be
+// applied inside the global middleware so the logger is available.
+func (b *Bulkhead) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		l := ctxkey.LoggerFrom(ctx)
+
+		select {
+		case b.slots <- struct{}{}:
+		default:
+			if b.queued.Add(1) > int64(b.options.MaxQueue) {
+				b.queued.Add(-1)
+				b.reject(w, r, l)
+				return
+			}
+			var timeout <-chan time.Time
+			if b.options.QueueTimeout > 0 {
+				timer := time.NewTimer(b.options.QueueTimeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+			select {
+			case b.slots <- struct{}{}:
+				b.queued.Add(-1)
+			case <-timeout:
+				b.queued.Add(-1)
+				b.reject(w, r, l)
+				return
+			case <-ctx.Done():
+				b.queued.Add(-1)
+				b.reject(w, r, l)
+				return
+			}
+		}
+
+		b.active.Add(1)
+		defer func() {
+			b.active.Add(-1)
+			<-b.slots
+			rec := recover()
+			if rec == nil {
+				b.completed.Add(1)
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			b.panics.Add(1)
+			l.ErrorContext(ctx, "Recovered panic in bulkhead.",
+				constant.LogErr, fmt.Errorf("%v\n%s", rec, debug.Stack()),
+				constant.LogTask, b.options.Name,
+			)
+			WriteErrorBody(ctx, http.StatusInternalServerError, constant.RespInternalServerError, w)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stats returns the current counters.
+func (b *Bulkhead) Stats() BulkheadStats {
+	return BulkheadStats{
+		Active:    b.active.Load(),
+		Completed: b.completed.Load(),
+		Name:      b.options.Name,
+		Panics:    b.panics.Load(),
+		Queued:    b.queued.Load(),
+		Rejected:  b.rejected.Load(),
+	}
+}
+
+func (b *Bulkhead) reject(w http.ResponseWriter, r *http.Request, l *slog.Logger) {
+	b.rejected.Add(1)
+	l.WarnContext(r.Context(), "Bulkhead rejected request.",
+		constant.LogTask, b.options.Name,
+	)
+	WriteErrorBody(r.Context(), http.StatusServiceUnavailable, "Server is busy.", w)
+}
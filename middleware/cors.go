@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+)
+
+// CORSOptions are the options for CORS middleware.
+type CORSOptions struct {
+	AllowCredentials bool
+	AllowedHeaders   []string
+	AllowedMethods   []string
+	// AllowedOrigins are the origins allowed to make cross-origin requests. Use "*" to allow any origin. Origins only
+	// allowed by "*" are never sent credentials, even if AllowCredentials is true.
+	AllowedOrigins []string
+	ExposedHeaders []string
+	MaxAge         time.Duration
+}
+
+// CreateCORS creates a middleware that adds CORS headers to the response and answers preflight requests.
+func CreateCORS(options CORSOptions) Middleware {
+	anyOrigin := slices.Contains(options.AllowedOrigins, "*")
+	allowHeaders := strings.Join(options.AllowedHeaders, ", ")
+	allowMethods := strings.Join(options.AllowedMethods, ", ")
+	exposeHeaders := strings.Join(options.ExposedHeaders, ", ")
+	maxAge := strconv.FormatInt(int64(options.MaxAge/time.Second), 10)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get(constant.HeaderOrigin)
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add(constant.HeaderVary, constant.HeaderOrigin)
+			listed := slices.Contains(options.AllowedOrigins, origin)
+			if !anyOrigin && !listed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if listed {
+				w.Header().Set(constant.HeaderAccessControlAllowOrigin, origin)
+				if options.AllowCredentials {
+					w.Header().Set(constant.HeaderAccessControlAllowCredentials, "true")
+				}
+			} else {
+				w.Header().Set(constant.HeaderAccessControlAllowOrigin, "*")
+			}
+			if exposeHeaders != "" {
+				w.Header().Set(constant.HeaderAccessControlExposeHeaders, exposeHeaders)
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get(constant.HeaderAccessControlRequestMethod) != ""
+			if !preflight {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if allowMethods != "" {
+				w.Header().Set(constant.HeaderAccessControlAllowMethods, allowMethods)
+			}
+			if allowHeaders != "" {
+				w.Header().Set(constant.HeaderAccessControlAllowHeaders, allowHeaders)
+			}
+			if options.MaxAge > 0 {
+				w.Header().Set(constant.HeaderAccessControlMaxAge, maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
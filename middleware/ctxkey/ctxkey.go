@@ -1,14 +1,71 @@
 // Package ctxkey contains the context keys used by httphandle.
 package ctxkey
 
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
 const (
 	// Logger is the context key a logger.
 	Logger ContextKey = iota
 	// ReqUUID is the context key a request UUID.
 	ReqUUID
-	// Tx is the context key for a database transaction.
+	// Tx is the context key for a database transaction, such as a pgx.Tx or *sql.Tx.
 	Tx
+	// MemoryBudget is the context key for a per-request memory budget.
+	MemoryBudget
+	// Timing is the context key for a per-request timing recorder.
+	Timing
+	// TxOptions is the context key for the options of a request's database transaction.
+	TxOptions
+	// DBTx is the context key for the dbtx.Tx of a request's database transaction.
+	DBTx
+	// Identity is the context key for the authenticated identity of a request.
+	Identity
+	// NoEnvelope is the context key that marks API responses to be sent without the data and metadata envelope.
+	NoEnvelope
+	// JSONOptions is the context key for the JSON options of API handlers.
+	JSONOptions
+	// Clock is the context key for a function that returns the current time, such as a fake clock in tests.
+	Clock
 )
 
 // ContextKey is the type of context keys.
 type ContextKey int
+
+// LoggerFrom returns the request's logger, or slog.Default if the context has none, such as outside the global
+// middleware in tests and background jobs.
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	l, ok := ctx.Value(Logger).(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+	return l
+}
+
+// NowFrom returns the current time from the context's clock, or time.Now if the context has none. Handlers whose output
+// includes the current time can use it so tests can fix the time, such as with hhtest.Clock.
+func NowFrom(ctx context.Context) time.Time {
+	now, ok := ctx.Value(Clock).(func() time.Time)
+	if !ok {
+		return time.Now()
+	}
+	return now()
+}
+
+// ReqUUIDFrom returns the request UUID. It returns uuid.Nil and false if the context has none.
+func ReqUUIDFrom(ctx context.Context) (uuid.UUID, bool) {
+	reqUUID, ok := ctx.Value(ReqUUID).(uuid.UUID)
+	return reqUUID, ok
+}
+
+// TxFrom returns the request's pgx transaction. It returns false if the context has none or it is not a pgx.Tx.
+func TxFrom(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(Tx).(pgx.Tx)
+	return tx, ok
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// ChaosOptions are the options for the chaos middleware.
+type ChaosOptions struct {
+	// ErrorRate is the fraction of requests, from 0 to 1, that fail with a 500 before reaching the handler.
+	ErrorRate float64
+	// MaxLatency is the maximum random delay added before each request.
+	MaxLatency time.Duration
+}
+
+// CreateChaos creates a development middleware that adds random latency and failures to exercise client error
+// handling. It must be applied inside the global middleware.
+func CreateChaos(options ChaosOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if options.MaxLatency > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(rand.N(options.MaxLatency)):
+				}
+			}
+			if options.ErrorRate > 0 && rand.Float64() < options.ErrorRate {
+				WriteErrorBody(ctx, http.StatusInternalServerError, "Chaos middleware injected failure.", w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DebugRequest is a development middleware that logs the request headers and the response status at debug level. It
+// must be applied inside the global middleware.
+func DebugRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		l := ctxkey.LoggerFrom(ctx)
+		sw := NewStatusWriter(w)
+		start := time.Now()
+		next.ServeHTTP(sw, r)
+		l.DebugContext(ctx, "Handled request.",
+			constant.LogHeader, r.Header,
+			constant.LogRespCode, sw.Status(),
+			constant.LogDuration, time.Since(start),
+		)
+	})
+}
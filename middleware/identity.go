@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// Identity is the authenticated user or client of a request. Authentication middleware, like CreateBasicAuth, adds it
+// to the request context, so Authorize methods and templates use the same representation of the user.
+type Identity struct {
+	// Attributes are other claims about the subject, such as an email address or tenant.
+	Attributes map[string]string
+	// Roles are the roles granted to the subject, checked with HasRole.
+	Roles []string
+	// Subject identifies the user or client, such as a username or user ID.
+	Subject string
+}
+
+// HasRole reports whether the identity has the role.
+func (i Identity) HasRole(role string) bool {
+	return slices.Contains(i.Roles, role)
+}
+
+// WithIdentity returns a copy of the context with the identity. Use it in custom authentication middleware.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, ctxkey.Identity, identity)
+}
+
+// IdentityFrom returns the identity of the request. It returns false if the request is not authenticated.
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(ctxkey.Identity).(Identity)
+	return identity, ok
+}
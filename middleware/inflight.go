@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// InFlight counts the requests being handled. The zero value is ready to use.
+type InFlight struct {
+	count atomic.Int64
+}
+
+// Middleware counts the requests it handles until they return.
+func (i *InFlight) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i.count.Add(1)
+		defer i.count.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Count returns the number of requests being handled.
+func (i *InFlight) Count() int64 {
+	return i.count.Load()
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// FanoutHandler is a slog.Handler that sends log records to every handler that is enabled for them. It is used to also
+// capture the request's logs, such as for a development error page, without replacing its logger.
+type FanoutHandler []slog.Handler
+
+// Enabled reports whether any of the handlers is enabled for the level.
+func (f FanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle sends a clone of the record to every handler that is enabled for its level. The errors are joined.
+func (f FanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs adds the attributes to every handler.
+func (f FanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(FanoutHandler, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+// WithGroup starts the group in every handler.
+func (f FanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(FanoutHandler, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
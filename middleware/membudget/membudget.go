@@ -0,0 +1,104 @@
+// Package membudget accounts for the memory a request uses for its body, decoded JSON, and template buffers against a
+// per-request budget. The accounting is an estimate based on byte counts, not a measurement of heap allocations.
+package membudget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// ErrExceeded is returned when a request uses more than its memory budget.
+var ErrExceeded = errors.New("request memory budget exceeded")
+
+// Budget tracks the bytes charged to a request. It is safe for concurrent use.
+type Budget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// New creates a Budget with the given limit in bytes.
+func New(limit int64) *Budget {
+	return &Budget{
+		limit: limit,
+	}
+}
+
+// Charge adds n bytes to the budget. It returns ErrExceeded if the total is over the limit.
+func (b *Budget) Charge(n int64) error {
+	used := b.used.Add(n)
+	if used > b.limit {
+		return fmt.Errorf("%w: used %d of %d bytes", ErrExceeded, used, b.limit)
+	}
+	return nil
+}
+
+// Limit returns the limit in bytes.
+func (b *Budget) Limit() int64 {
+	return b.limit
+}
+
+// Used returns the bytes charged so far.
+func (b *Budget) Used() int64 {
+	return b.used.Load()
+}
+
+// Exceeded reports if more than the limit has been charged.
+func (b *Budget) Exceeded() bool {
+	return b.used.Load() > b.limit
+}
+
+// FromContext returns the request's Budget, or nil if the request has none.
+func FromContext(ctx context.Context) *Budget {
+	b, _ := ctx.Value(ctxkey.MemoryBudget).(*Budget)
+	return b
+}
+
+// NewContext returns a copy of ctx carrying the Budget.
+func NewContext(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, ctxkey.MemoryBudget, b)
+}
+
+// Charge adds n bytes to the request's Budget. It does nothing if the request has no Budget.
+func Charge(ctx context.Context, n int64) error {
+	b := FromContext(ctx)
+	if b == nil {
+		return nil
+	}
+	return b.Charge(n)
+}
+
+// Reader charges the bytes read from the underlying reader to a Budget.
+type Reader struct {
+	budget *Budget
+	reader io.ReadCloser
+}
+
+// NewReader wraps r so every read is charged to the Budget.
+func NewReader(b *Budget, r io.ReadCloser) *Reader {
+	return &Reader{
+		budget: b,
+		reader: r,
+	}
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		chargeErr := r.budget.Charge(int64(n))
+		if chargeErr != nil {
+			return n, chargeErr
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (r *Reader) Close() error {
+	return r.reader.Close()
+}
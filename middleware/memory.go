@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+	"github.com/MicahParks/httphandle/middleware/membudget"
+)
+
+// MemoryBudgetOptions are the options for the memory budget middleware.
+type MemoryBudgetOptions struct {
+	// Limit is the number of bytes a request may charge for its body, decoded JSON, and template buffers.
+	Limit int64
+	// OnExceeded, if not nil, is called after a request exceeded its budget. Use it to record a metric.
+	OnExceeded func(r *http.Request, used int64)
+}
+
+// CreateMemoryBudget creates a middleware that adds a membudget.Budget to the request context and charges the request
+// body to it. api.ExtractJSON responds with 413 when the budget is exceeded and template handlers respond with 500.
+// It must be applied inside the global middleware so the logger is available.
+func CreateMemoryBudget(options MemoryBudgetOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			budget := membudget.New(options.Limit)
+			ctx := membudget.NewContext(r.Context(), budget)
+			r = r.WithContext(ctx)
+			r.Body = membudget.NewReader(budget, r.Body)
+			next.ServeHTTP(w, r)
+			if !budget.Exceeded() {
+				return
+			}
+			l := ctxkey.LoggerFrom(ctx)
+			l.WarnContext(ctx, "Request exceeded memory budget.",
+				constant.LogBudget, budget.Limit(),
+				constant.LogCount, budget.Used(),
+			)
+			if options.OnExceeded != nil {
+				options.OnExceeded(r, budget.Used())
+			}
+		})
+	}
+}
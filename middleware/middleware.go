@@ -4,7 +4,6 @@ package middleware
 import (
 	"compress/gzip"
 	"context"
-	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
@@ -17,6 +16,7 @@ import (
 
 	"github.com/MicahParks/httphandle/api"
 	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/dbtx"
 	"github.com/MicahParks/httphandle/middleware/ctxkey"
 )
 
@@ -55,13 +55,24 @@ type Middleware func(next http.Handler) http.Handler
 
 // GlobalOptions are the options for global middleware.
 type GlobalOptions struct {
-	MaxReqSize uint32
-	ReqTimeout time.Duration
+	MaxReqSize uint32        `json:"maxReqSize"`
+	ReqTimeout time.Duration `json:"reqTimeout"`
+	// SkipReqSizeLimit leaves the request body unlimited, ignoring MaxReqSize.
+	SkipReqSizeLimit bool `json:"skipReqSizeLimit"`
+	// SkipReqTimeout leaves the request context without a deadline, ignoring ReqTimeout.
+	SkipReqTimeout bool `json:"skipReqTimeout"`
 }
 
 // ApplyGlobal applies global middleware to a handler.
 func ApplyGlobal(h http.Handler, l *slog.Logger, options GlobalOptions) http.Handler {
-	return Wrap(h, CreateAddLogger(l), RequestUUID, CreateAddCtx(options.ReqTimeout), CreateLimitReqSize(int64(options.MaxReqSize)))
+	mw := []Middleware{CreateAddLogger(l), RequestUUID}
+	if !options.SkipReqTimeout {
+		mw = append(mw, CreateAddCtx(options.ReqTimeout))
+	}
+	if !options.SkipReqSizeLimit {
+		mw = append(mw, CreateLimitReqSize(int64(options.MaxReqSize)))
+	}
+	return Wrap(h, mw...)
 }
 
 // ApplyGlobalDefaults applies global middleware to a handler with default options.
@@ -95,7 +106,7 @@ func CreateAddLogger(l *slog.Logger) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
-			reqUUID := ctx.Value(ctxkey.ReqUUID).(uuid.UUID)
+			reqUUID, _ := ctxkey.ReqUUIDFrom(ctx)
 			logger := l.With( // Better to have short declaration than reassignment.
 				FieldKeyMethod, r.Method,
 				FieldKeyReqUUID, reqUUID.String(),
@@ -108,14 +119,44 @@ func CreateAddLogger(l *slog.Logger) Middleware {
 	}
 }
 
-// CreateAddTx creates a middleware that adds a transaction to the request.
+// CreateAddTx creates a middleware that adds a transaction to the request. A *pgxpool.Pool's Begin method can be used
+// as begin. The transaction is rolled back after the handler returns unless the handler committed it. begin can't take
+// transaction options, so use CreateAddTxOptions for CreateTxOptions and httphandle.TxPolicer to have an effect.
 func CreateAddTx(begin func(ctx context.Context) (pgx.Tx, error)) Middleware {
+	return CreateAddTxOptions(func(ctx context.Context, _ pgx.TxOptions) (pgx.Tx, error) {
+		return begin(ctx)
+	}, pgx.TxOptions{})
+}
+
+// CreateAddTxOptions creates a middleware that adds a pgx transaction to the request. The transaction is started with
+// the given options, such as the isolation level or read-only access mode, unless CreateTxOptions set other options for
+// the request. A *pgxpool.Pool's BeginTx method can be used as begin. The transaction is rolled back after the handler
+// returns unless the handler committed it.
+func CreateAddTxOptions(begin func(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error), options pgx.TxOptions) Middleware {
+	return CreateAddDBTx(dbtx.PgxBeginner(begin, options), false)
+}
+
+// CreateAddTxAutoCommit is like CreateAddTxOptions, but commits the transaction automatically. See CreateAddDBTx.
+func CreateAddTxAutoCommit(begin func(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error), options pgx.TxOptions) Middleware {
+	return CreateAddDBTx(dbtx.PgxBeginner(begin, options), true)
+}
+
+// CreateAddDBTx creates a middleware that adds a transaction from any database driver to the request, such as one
+// from dbtx.SQLBeginner. The driver's transaction is stored under ctxkey.Tx and the dbtx.Tx under ctxkey.DBTx. The
+// transaction is rolled back after the handler returns unless it was committed. Wrap the beginner with
+// dbtx.StatementTimeout to have Postgres cancel queries that outlive the request timeout.
+//
+// If autoCommit is true, the transaction is committed when the handler writes a 2xx or 3xx status code and rolled back
+// otherwise. The commit happens before the status code is sent, so if it fails the client gets a 500 response instead
+// and the rest of the handler's response is discarded. A handler that writes nothing gets a 200 and its transaction is
+// committed.
+func CreateAddDBTx(beginner dbtx.Beginner, autoCommit bool) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
-			l := ctx.Value(ctxkey.Logger).(*slog.Logger)
+			l := ctxkey.LoggerFrom(ctx)
 
-			tx, err := begin(ctx)
+			tx, err := beginner.Begin(ctx)
 			if err != nil {
 				l.ErrorContext(ctx, constant.MsgFailTransactionBegin,
 					constant.LogErr, err,
@@ -124,12 +165,26 @@ func CreateAddTx(begin func(ctx context.Context) (pgx.Tx, error)) Middleware {
 				return
 			}
 
-			ctx = context.WithValue(ctx, ctxkey.Tx, tx)
+			ctx = context.WithValue(ctx, ctxkey.Tx, tx.Driver())
+			ctx = context.WithValue(ctx, ctxkey.DBTx, tx)
 			r = r.WithContext(ctx)
-			next.ServeHTTP(w, r)
+			if autoCommit {
+				cw := &commitWriter{
+					ResponseWriter: w,
+					ctx:            ctx,
+					l:              l,
+					tx:             tx,
+				}
+				next.ServeHTTP(cw, r)
+				if !cw.decided {
+					cw.WriteHeader(http.StatusOK)
+				}
+			} else {
+				next.ServeHTTP(w, r)
+			}
 
 			err = tx.Rollback(ctx)
-			if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			if err != nil && !errors.Is(err, dbtx.ErrTxClosed) {
 				l.ErrorContext(ctx, constant.MsgFailTransactionRollback,
 					constant.LogErr, err,
 				)
@@ -139,6 +194,18 @@ func CreateAddTx(begin func(ctx context.Context) (pgx.Tx, error)) Middleware {
 	}
 }
 
+// CreateTxOptions creates a middleware that overrides the options CreateAddTxOptions and CreateAddTxAutoCommit start
+// the request's transaction with. It must be applied outside of them.
+func CreateTxOptions(options pgx.TxOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ctxkey.TxOptions, options)
+			r = r.WithContext(ctx)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 type CacheControlOptions struct {
 	MaxAge  time.Duration
 	NoCache bool
@@ -226,9 +293,27 @@ func RequestUUID(next http.Handler) http.Handler {
 	})
 }
 
-// WriteErrorBody writes an error body to the response writer.
+// WriteReadBodyError writes the error body for an error from reading the request body. If the body is larger than
+// the limit of CreateLimitReqSize, it is a 413 with the limit in the message and the connection is closed after the
+// response, because the rest of the body is unread. Otherwise, it is a 400.
+func WriteReadBodyError(ctx context.Context, err error, writer http.ResponseWriter) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writer.Header().Set(constant.HeaderConnection, "close")
+		WriteErrorBody(ctx, http.StatusRequestEntityTooLarge, api.TooLargeMessage(maxBytesErr.Limit), writer)
+		return
+	}
+	WriteErrorBody(ctx, http.StatusBadRequest, "Failed to read request body.", writer)
+}
+
+// WriteErrorBody writes an error body to the response writer with the default error code of the HTTP status code.
 func WriteErrorBody(ctx context.Context, code int, message string, writer http.ResponseWriter) {
-	data, err := json.Marshal(api.NewAPIError(ctx, code, message))
+	WriteErrorBodyCode(ctx, code, api.StatusErrorCode(code), message, writer)
+}
+
+// WriteErrorBodyCode writes an error body with an error code, such as api.CodeInvalidJSON, to the response writer.
+func WriteErrorBodyCode(ctx context.Context, code int, errorCode, message string, writer http.ResponseWriter) {
+	data, err := api.MarshalResponse(ctx, api.NewAPIErrorCode(ctx, code, errorCode, message))
 	if err != nil {
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
@@ -238,11 +323,69 @@ func WriteErrorBody(ctx context.Context, code int, message string, writer http.R
 	_, _ = writer.Write(data)
 }
 
+// errCommitFailed is returned by commitWriter.Write after the transaction failed to commit.
+var errCommitFailed = errors.New("response discarded because the transaction failed to commit")
+
+// commitWriter commits the request's transaction when a successful status code is written.
+type commitWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	decided bool
+	failed  bool
+	l       *slog.Logger
+	tx      dbtx.Tx
+}
+
+// Unwrap returns the wrapped http.ResponseWriter for use with http.ResponseController.
+func (c *commitWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *commitWriter) Write(b []byte) (int, error) {
+	if !c.decided {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.failed {
+		return 0, errCommitFailed
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *commitWriter) WriteHeader(code int) {
+	if c.failed {
+		return
+	}
+	if !c.decided && code >= http.StatusOK {
+		c.decided = true
+		if code < http.StatusBadRequest {
+			err := c.tx.Commit(c.ctx)
+			if err != nil && !errors.Is(err, dbtx.ErrTxClosed) {
+				c.l.ErrorContext(c.ctx, constant.MsgFailTransactionCommit,
+					constant.LogErr, err,
+				)
+				c.failed = true
+				WriteErrorBody(c.ctx, http.StatusInternalServerError, constant.RespInternalServerError, c.ResponseWriter)
+				return
+			}
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
 type gzipResponseWriter struct {
 	http.ResponseWriter
 	writer *gzip.Writer
 }
 
+// Write removes the Content-Length header, which is the length of the uncompressed body, in case the status code is
+// sent implicitly.
 func (w gzipResponseWriter) Write(b []byte) (int, error) {
+	w.ResponseWriter.Header().Del(constant.HeaderContentLength)
 	return w.writer.Write(b)
 }
+
+// WriteHeader removes the Content-Length header, which is the length of the uncompressed body.
+func (w gzipResponseWriter) WriteHeader(code int) {
+	w.ResponseWriter.Header().Del(constant.HeaderContentLength)
+	w.ResponseWriter.WriteHeader(code)
+}
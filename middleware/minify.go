@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/MicahParks/httphandle/constant"
+)
+
+// MinifyHTML is a middleware that removes redundant whitespace from HTML responses as they are written. Runs of
+// whitespace in text content and inline CSS are collapsed to a single space. The contents of <pre>, <textarea>, and
+// <script> elements, tag attributes, and quoted CSS strings are left untouched.
+//
+// Responses with a Content-Type other than text/html are passed through. Apply this middleware inside EncodeGzip so
+// that the minified output is what gets compressed.
+func MinifyHTML(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := &minifyResponseWriter{
+			ResponseWriter: w,
+		}
+		next.ServeHTTP(mw, r)
+	})
+}
+
+type minifyResponseWriter struct {
+	http.ResponseWriter
+	decided  bool
+	minifier *htmlMinifier
+}
+
+func (w *minifyResponseWriter) WriteHeader(code int) {
+	w.decide()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *minifyResponseWriter) Write(b []byte) (int, error) {
+	w.decide()
+	if w.minifier == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.minifier.Write(b)
+}
+
+func (w *minifyResponseWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	contentType := w.Header().Get(constant.HeaderContentType)
+	if contentType != "" && !strings.HasPrefix(contentType, constant.ContentTypeHTML) {
+		return
+	}
+	w.Header().Del(constant.HeaderContentLength)
+	w.minifier = &htmlMinifier{
+		w: w.ResponseWriter,
+	}
+}
+
+// htmlMinifier is a streaming whitespace minifier. Its state is kept between calls to Write so that tags and
+// whitespace runs split across writes are handled.
+type htmlMinifier struct {
+	w io.Writer
+
+	buf          bytes.Buffer
+	inTag        bool
+	tagName      []byte
+	readingName  bool
+	tagQuote     byte
+	rawElement   string
+	cssQuote     byte
+	pendingSpace bool
+}
+
+func (m *htmlMinifier) Write(b []byte) (int, error) {
+	m.buf.Reset()
+	for _, c := range b {
+		m.process(c)
+	}
+	_, err := m.w.Write(m.buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (m *htmlMinifier) process(c byte) {
+	if m.inTag {
+		m.processTag(c)
+		return
+	}
+
+	switch m.rawElement {
+	case "pre", "textarea", "script":
+		if c == '<' {
+			m.openTag()
+		}
+		m.buf.WriteByte(c)
+		return
+	case "style":
+		if m.cssQuote != 0 {
+			if c == m.cssQuote {
+				m.cssQuote = 0
+			}
+			m.buf.WriteByte(c)
+			return
+		}
+		if c == '"' || c == '\'' {
+			m.cssQuote = c
+		}
+	}
+
+	if isHTMLSpace(c) {
+		m.pendingSpace = true
+		return
+	}
+	if m.pendingSpace {
+		m.buf.WriteByte(' ')
+		m.pendingSpace = false
+	}
+	if c == '<' {
+		m.openTag()
+	}
+	m.buf.WriteByte(c)
+}
+
+func (m *htmlMinifier) openTag() {
+	m.inTag = true
+	m.readingName = true
+	m.tagName = m.tagName[:0]
+	m.tagQuote = 0
+}
+
+func (m *htmlMinifier) processTag(c byte) {
+	m.buf.WriteByte(c)
+
+	if m.readingName {
+		if isTagNameByte(c, len(m.tagName)) {
+			m.tagName = append(m.tagName, toASCIILower(c))
+			return
+		}
+		m.readingName = false
+		if len(m.tagName) == 0 && c != '!' && c != '?' {
+			// A lone "<" is text, not the start of a tag.
+			m.inTag = false
+			return
+		}
+		m.nameRead()
+		if !m.inTag {
+			return
+		}
+	}
+
+	if m.tagQuote != 0 {
+		if c == m.tagQuote {
+			m.tagQuote = 0
+		}
+		return
+	}
+	switch c {
+	case '"', '\'':
+		m.tagQuote = c
+	case '>':
+		m.inTag = false
+	}
+}
+
+func (m *htmlMinifier) nameRead() {
+	name := string(m.tagName)
+	closing := strings.HasPrefix(name, "/")
+	name = strings.TrimPrefix(name, "/")
+
+	if m.rawElement != "" && m.rawElement != "style" {
+		// Inside a raw element, only its closing tag is a real tag.
+		if !closing || name != m.rawElement {
+			m.inTag = false
+			return
+		}
+	}
+
+	switch name {
+	case "pre", "textarea", "script", "style":
+		if closing {
+			if name == m.rawElement {
+				m.rawElement = ""
+				m.cssQuote = 0
+			}
+		} else if m.rawElement == "" {
+			m.rawElement = name
+		}
+	}
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isTagNameByte(c byte, position int) bool {
+	if position == 0 {
+		return c == '/' || isASCIILetter(c)
+	}
+	return isASCIILetter(c) || c >= '0' && c <= '9' || c == '-'
+}
+
+func isHTMLSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\f':
+		return true
+	}
+	return false
+}
+
+func toASCIILower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// StatusWriter is an http.ResponseWriter that remembers the status code written to it.
+type StatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// NewStatusWriter wraps w in a StatusWriter.
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{
+		ResponseWriter: w,
+	}
+}
+
+// Status returns the status code written, http.StatusOK if only the body was written, or zero if nothing was written.
+func (s *StatusWriter) Status() int {
+	return s.status
+}
+
+// Unwrap returns the wrapped http.ResponseWriter for use with http.ResponseController.
+func (s *StatusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *StatusWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *StatusWriter) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,39 @@
+// Package timing lets code report how long parts of a request took, such as template rendering, to a recorder in the
+// request context.
+package timing
+
+import (
+	"context"
+	"time"
+
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// Recorder receives the timings of a request.
+type Recorder func(name string, d time.Duration)
+
+// NewContext returns a copy of ctx carrying the Recorder. An existing Recorder in ctx also keeps receiving timings.
+func NewContext(ctx context.Context, recorder Recorder) context.Context {
+	parent, ok := ctx.Value(ctxkey.Timing).(Recorder)
+	if ok {
+		child := recorder
+		recorder = func(name string, d time.Duration) {
+			parent(name, d)
+			child(name, d)
+		}
+	}
+	return context.WithValue(ctx, ctxkey.Timing, recorder)
+}
+
+// Record reports a timing to the request's Recorder. It does nothing if the request has none.
+func Record(ctx context.Context, name string, d time.Duration) {
+	recorder, ok := ctx.Value(ctxkey.Timing).(Recorder)
+	if ok {
+		recorder(name, d)
+	}
+}
+
+// Since reports the time since start. Use it with defer.
+func Since(ctx context.Context, name string, start time.Time) {
+	Record(ctx, name, time.Since(start))
+}
@@ -0,0 +1,91 @@
+package pageview
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MicahParks/httphandle"
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// DefaultDashboardDays is the default number of days shown on the dashboard.
+const DefaultDashboardDays = 30
+
+// DashboardData is the template data for the dashboard.
+type DashboardData struct {
+	Days       int
+	Paths      []PathStats
+	TotalViews int64
+}
+
+// Dashboard is a template handler that shows page view statistics. The application provides the template.
+type Dashboard[A httphandle.AppSpecific] struct {
+	// AuthorizeFunc decides who can see the dashboard. If nil, every request is unauthorized.
+	AuthorizeFunc func(w http.ResponseWriter, r *http.Request) (authorized bool, modified *http.Request, skipTemplate bool)
+	Days          int
+	Pattern       string
+	Recorder      *Recorder
+	Template      string
+	// WrapperData creates the wrapper template data for a request.
+	WrapperData func(r *http.Request) httphandle.WrapperData
+	Wrapper     string
+}
+
+func (d Dashboard[A]) ApplyMiddleware(h http.Handler) http.Handler {
+	return h
+}
+
+func (d Dashboard[A]) Authorize(w http.ResponseWriter, r *http.Request) (authorized bool, modified *http.Request, skipTemplate bool) {
+	if d.AuthorizeFunc == nil {
+		return false, r, false
+	}
+	return d.AuthorizeFunc(w, r)
+}
+
+func (d Dashboard[A]) Initialize(A) error {
+	if d.Recorder == nil || d.WrapperData == nil {
+		return errors.New("page view dashboard requires a Recorder and WrapperData")
+	}
+	return nil
+}
+
+func (d Dashboard[A]) Respond(r *http.Request) (meta httphandle.TemplateRespMeta, templateData any, wrapperData httphandle.WrapperData) {
+	ctx := r.Context()
+	wrapperData = d.WrapperData(r)
+
+	days := d.Days
+	if days == 0 {
+		days = DefaultDashboardDays
+	}
+	stats, err := d.Recorder.Stats(ctx, days)
+	if err != nil {
+		l := ctxkey.LoggerFrom(ctx)
+		l.ErrorContext(ctx, "Failed to get page view stats.",
+			constant.LogErr, err,
+		)
+		meta.ResponseCode = http.StatusInternalServerError
+		return meta, nil, wrapperData
+	}
+
+	data := DashboardData{
+		Days:  days,
+		Paths: stats,
+	}
+	for _, s := range stats {
+		data.TotalViews += s.Views
+	}
+	return meta, data, wrapperData
+}
+
+func (d Dashboard[A]) TemplateName() string {
+	return d.Template
+}
+
+func (d Dashboard[A]) URLPattern() string {
+	return d.Pattern
+}
+
+func (d Dashboard[A]) WrapperTemplateName() string {
+	return d.Wrapper
+}
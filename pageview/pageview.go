@@ -0,0 +1,192 @@
+// Package pageview records aggregate page-view counts without cookies and shows them on a dashboard.
+//
+// Visitors are counted by hashing their IP address and User-Agent with a random salt that changes every UTC day and is
+// never stored. The hashes can't be reversed or linked across days. The salt is also regenerated when the process
+// restarts, so a restart in the middle of a day may count some visitors twice.
+package pageview
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+// DefaultFlushInterval is the default interval for writing counts to the Store.
+const DefaultFlushInterval = time.Minute
+
+// Key identifies an aggregate count.
+type Key struct {
+	Day     time.Time
+	Path    string
+	Visitor [16]byte
+}
+
+// PathStats are the aggregate statistics of a path.
+type PathStats struct {
+	Path  string
+	Views int64
+	// Visitors is the sum of each day's unique visitors, because visitors can't be linked across days.
+	Visitors int64
+}
+
+// Store persists aggregate counts.
+type Store interface {
+	// Add adds the counts to the stored totals.
+	Add(ctx context.Context, counts map[Key]int64) error
+	// Stats returns the statistics for every path since the given day, ordered by views.
+	Stats(ctx context.Context, since time.Time) ([]PathStats, error)
+}
+
+// Options are the options for a Recorder.
+type Options struct {
+	FlushInterval time.Duration
+	Logger        *slog.Logger
+	// RemoteIP returns the client's IP address. Set it when the server is behind a proxy. The default uses the
+	// request's remote address.
+	RemoteIP func(r *http.Request) string
+	Store    Store
+}
+
+// Recorder counts page views in memory and periodically adds them to the Store.
+type Recorder struct {
+	cancel  context.CancelFunc
+	counts  map[Key]int64
+	done    chan struct{}
+	mux     sync.Mutex
+	options Options
+	salt    []byte
+	saltDay time.Time
+}
+
+// NewRecorder creates a Recorder and starts flushing counts in the background. Call Close to flush and stop.
+func NewRecorder(options Options) (*Recorder, error) {
+	if options.Store == nil {
+		return nil, errors.New("a page view store is required")
+	}
+	if options.FlushInterval == 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	if options.RemoteIP == nil {
+		options.RemoteIP = middleware.RemoteIP
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Recorder{
+		cancel:  cancel,
+		counts:  make(map[Key]int64),
+		done:    make(chan struct{}),
+		options: options,
+	}
+	go r.run(ctx)
+	return r, nil
+}
+
+// Close stops the background flushing and writes the remaining counts to the Store. It can be used as
+// ServeArgs.ShutdownFunc.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.cancel()
+	<-r.done
+	return r.flush(ctx)
+}
+
+// Middleware records successful GET requests for HTML pages. Requests without a User-Agent or with a User-Agent that
+// looks like a bot are not counted.
+func (r *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sw := middleware.NewStatusWriter(w)
+		next.ServeHTTP(sw, req)
+		if req.Method != http.MethodGet || sw.Status() != http.StatusOK {
+			return
+		}
+		contentType := w.Header().Get(constant.HeaderContentType)
+		if contentType != "" && !strings.HasPrefix(contentType, constant.ContentTypeHTML) {
+			return
+		}
+		userAgent := req.UserAgent()
+		if userAgent == "" || strings.Contains(strings.ToLower(userAgent), "bot") {
+			return
+		}
+		r.record(req.URL.Path, r.options.RemoteIP(req), userAgent)
+	})
+}
+
+// Stats returns the statistics for every path over the given number of days, including today.
+func (r *Recorder) Stats(ctx context.Context, days int) ([]PathStats, error) {
+	since := today().AddDate(0, 0, 1-days)
+	return r.options.Store.Stats(ctx, since)
+}
+
+func (r *Recorder) record(path, ip, userAgent string) {
+	day := today()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !day.Equal(r.saltDay) {
+		salt := make([]byte, 32)
+		_, _ = rand.Read(salt)
+		r.salt = salt
+		r.saltDay = day
+	}
+	h := sha256.New()
+	h.Write(r.salt)
+	h.Write([]byte(ip))
+	h.Write([]byte{0})
+	h.Write([]byte(userAgent))
+	key := Key{
+		Day:  day,
+		Path: path,
+	}
+	copy(key.Visitor[:], h.Sum(nil))
+	r.counts[key]++
+}
+
+func (r *Recorder) flush(ctx context.Context) error {
+	r.mux.Lock()
+	counts := r.counts
+	r.counts = make(map[Key]int64)
+	r.mux.Unlock()
+	if len(counts) == 0 {
+		return nil
+	}
+	err := r.options.Store.Add(ctx, counts)
+	if err != nil {
+		return fmt.Errorf("failed to add page view counts to store: %w", err)
+	}
+	return nil
+}
+
+func (r *Recorder) run(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(r.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		flushCtx, cancel := context.WithTimeout(ctx, r.options.FlushInterval)
+		err := r.flush(flushCtx)
+		cancel()
+		if err != nil {
+			r.options.Logger.ErrorContext(ctx, "Failed to flush page views.",
+				constant.LogErr, err,
+			)
+		}
+	}
+}
+
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
@@ -0,0 +1,56 @@
+package pageview
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresSchema creates the table used by PostgresStore.
+const PostgresSchema = `CREATE TABLE IF NOT EXISTS page_views (
+	day     DATE   NOT NULL,
+	path    TEXT   NOT NULL,
+	visitor BYTEA  NOT NULL,
+	views   BIGINT NOT NULL,
+	PRIMARY KEY (day, path, visitor)
+)`
+
+// PostgresStore is a Store backed by the page_views table in PostgresSchema.
+type PostgresStore struct {
+	Pool *pgxpool.Pool
+}
+
+func (p PostgresStore) Add(ctx context.Context, counts map[Key]int64) error {
+	const query = `INSERT INTO page_views (day, path, visitor, views) VALUES ($1, $2, $3, $4)
+ON CONFLICT (day, path, visitor) DO UPDATE SET views = page_views.views + excluded.views`
+	batch := &pgx.Batch{}
+	for key, views := range counts {
+		batch.Queue(query, key.Day, key.Path, key.Visitor[:], views)
+	}
+	err := p.Pool.SendBatch(ctx, batch).Close()
+	if err != nil {
+		return fmt.Errorf("failed to upsert page views: %w", err)
+	}
+	return nil
+}
+
+func (p PostgresStore) Stats(ctx context.Context, since time.Time) ([]PathStats, error) {
+	const query = `SELECT path, SUM(views), COUNT(DISTINCT (day, visitor)) FROM page_views WHERE day >= $1
+GROUP BY path ORDER BY SUM(views) DESC, path`
+	rows, err := p.Pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query page view stats: %w", err)
+	}
+	stats, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (PathStats, error) {
+		var s PathStats
+		err := row.Scan(&s.Path, &s.Views, &s.Visitors)
+		return s, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan page view stats: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Cluster is a primary pool and read replica pools. Its BeginTx method can be passed to middleware.CreateAddTxOptions, so
+// read-only transactions, such as those of GET handlers that implement httphandle.TxPolicer, are routed to the
+// replicas. Replicas may lag behind the primary, so reads that must see the request's own writes need a read-write
+// transaction.
+type Cluster struct {
+	Primary  *pgxpool.Pool
+	Replicas []*pgxpool.Pool
+
+	next atomic.Uint64
+}
+
+// NewCluster creates a pool for Config.DSN and one for each of Config.ReplicaDSNs with the same settings.
+func NewCluster(ctx context.Context, config Config) (*Cluster, error) {
+	primary, err := Pool(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create primary pool: %w", err)
+	}
+	c := &Cluster{
+		Primary: primary,
+	}
+	for i, dsn := range config.ReplicaDSNs {
+		replicaConfig := config
+		replicaConfig.DSN = dsn
+		replica, err := Pool(ctx, replicaConfig)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to create replica pool %d: %w", i, err)
+		}
+		c.Replicas = append(c.Replicas, replica)
+	}
+	return c, nil
+}
+
+// BeginTx begins a transaction on a replica, chosen round-robin, if the options are read-only and there are replicas.
+// Otherwise, it begins the transaction on the primary.
+func (c *Cluster) BeginTx(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error) {
+	if options.AccessMode == pgx.ReadOnly && len(c.Replicas) != 0 {
+		return c.Replica().BeginTx(ctx, options)
+	}
+	return c.Primary.BeginTx(ctx, options)
+}
+
+// Replica returns a replica pool, chosen round-robin, or the primary if there are no replicas.
+func (c *Cluster) Replica() *pgxpool.Pool {
+	if len(c.Replicas) == 0 {
+		return c.Primary
+	}
+	i := c.next.Add(1) - 1
+	return c.Replicas[i%uint64(len(c.Replicas))]
+}
+
+// Close closes every pool.
+func (c *Cluster) Close() {
+	c.Primary.Close()
+	for _, replica := range c.Replicas {
+		replica.Close()
+	}
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector of the statistics of a pgxpool.Pool. Register it with the same registry as the
+// HTTP metrics to correlate request latency with pool exhaustion.
+type Collector struct {
+	pool *pgxpool.Pool
+
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	idleConns            *prometheus.Desc
+	maxConns             *prometheus.Desc
+	totalConns           *prometheus.Desc
+}
+
+// NewCollector creates a Collector for the pool. The metric names start with "pgxpool_". The labels, such as the name
+// of the database, are added to every metric and may be nil.
+func NewCollector(pool *pgxpool.Pool, labels prometheus.Labels) *Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("pgxpool_"+name, help, nil, labels)
+	}
+	return &Collector{
+		pool:                 pool,
+		acquireCount:         desc("acquires_total", "Cumulative count of successful acquires from the pool."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Total duration of all successful acquires from the pool."),
+		acquiredConns:        desc("acquired_conns", "Number of currently acquired connections in the pool."),
+		canceledAcquireCount: desc("canceled_acquires_total", "Cumulative count of acquires from the pool that were canceled by a context."),
+		constructingConns:    desc("constructing_conns", "Number of connections with construction in progress in the pool."),
+		emptyAcquireCount:    desc("empty_acquires_total", "Cumulative count of successful acquires from the pool that waited for a resource to be released or constructed because the pool was empty."),
+		idleConns:            desc("idle_conns", "Number of currently idle connections in the pool."),
+		maxConns:             desc("max_conns", "Maximum size of the pool."),
+		totalConns:           desc("total_conns", "Total number of connections currently in the pool."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.acquiredConns
+	ch <- c.canceledAcquireCount
+	ch <- c.constructingConns
+	ch <- c.emptyAcquireCount
+	ch <- c.idleConns
+	ch <- c.maxConns
+	ch <- c.totalConns
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+}
@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultHealthTimeout is the timeout of a HealthCheck.
+const DefaultHealthTimeout = 2 * time.Second
+
+// HealthCheck creates a check that pings the pool and runs a trivial query, with a DefaultHealthTimeout timeout. The
+// query catches connections that accept pings but can't run statements, such as during a failover. It can be added to
+// a health.Checker for readiness gating.
+func HealthCheck(pool *pgxpool.Pool) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, DefaultHealthTimeout)
+		defer cancel()
+		err := pool.Ping(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to ping Postgres: %w", err)
+		}
+		var one int
+		err = pool.QueryRow(ctx, "SELECT 1").Scan(&one)
+		if err != nil {
+			return fmt.Errorf("failed to query Postgres: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Release releases a session advisory lock and returns its connection to the pool.
+type Release func(ctx context.Context) error
+
+// LockKey derives an advisory lock key from a name, such as the name of a scheduled task, so replicas agree on the key
+// without coordinating numbers.
+func LockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// LockSession waits for the session advisory lock of the key. The lock is held on a connection from the pool until
+// the returned Release is called, even across transactions, so use it for singleton operations like scheduled tasks.
+// The lock is also released if the connection is lost.
+func LockSession(ctx context.Context, pool *pgxpool.Pool, key int64) (Release, error) {
+	release, _, err := lockSession(ctx, pool, key, false)
+	return release, err
+}
+
+// TryLockSession is like LockSession, but returns immediately. If the lock is held by another session, it returns
+// false and a nil Release.
+func TryLockSession(ctx context.Context, pool *pgxpool.Pool, key int64) (Release, bool, error) {
+	return lockSession(ctx, pool, key, true)
+}
+
+// LockTx waits for the transaction advisory lock of the key. It is released when the transaction ends.
+func LockTx(ctx context.Context, tx pgx.Tx, key int64) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", key)
+	if err != nil {
+		return fmt.Errorf("failed to acquire transaction advisory lock: %w", err)
+	}
+	return nil
+}
+
+// TryLockTx is like LockTx, but returns immediately. It returns false if the lock is held by another session.
+func TryLockTx(ctx context.Context, tx pgx.Tx, key int64) (bool, error) {
+	var locked bool
+	err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", key).Scan(&locked)
+	if err != nil {
+		return false, fmt.Errorf("failed to try transaction advisory lock: %w", err)
+	}
+	return locked, nil
+}
+
+func lockSession(ctx context.Context, pool *pgxpool.Pool, key int64, try bool) (Release, bool, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	locked := true
+	if try {
+		err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked)
+	} else {
+		_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", key)
+	}
+	if err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to acquire session advisory lock: %w", err)
+	}
+	if !locked {
+		conn.Release()
+		return nil, false, nil
+	}
+	return func(ctx context.Context) error {
+		defer conn.Release()
+		_, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", key)
+		if err != nil {
+			// The lock would stay held by the pooled connection, so the connection is closed to release it.
+			_ = conn.Conn().Close(ctx)
+			return fmt.Errorf("failed to release session advisory lock: %w", err)
+		}
+		return nil
+	}, true, nil
+}
@@ -0,0 +1,334 @@
+// Package migrate runs versioned SQL migrations from an fs.FS, such as an embed.FS, against a Postgres pool.
+//
+// Migration files are named "<version>_<name>.up.sql" and "<version>_<name>.down.sql", such as
+// "0001_create_users.up.sql". Versions are positive integers applied in ascending order. Down files are optional, but
+// are required to roll back their version. Applied versions are recorded in a table, and a Postgres advisory lock keeps
+// concurrent runners, such as several replicas starting at once, from applying the same migration twice.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DefaultLockID is the default key of the advisory lock held while migrating.
+	DefaultLockID = 8_675_309_000
+	// DefaultTable is the default table applied versions are recorded in.
+	DefaultTable = "schema_migrations"
+)
+
+var fileRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Options are the options for a Migrator.
+type Options struct {
+	// Dir is the directory of the fs.FS the migration files are in. The default is the root.
+	Dir string
+	// LockID is the key of the advisory lock. The default is DefaultLockID.
+	LockID int64
+	// Logger, if not nil, logs every migration applied or rolled back.
+	Logger *slog.Logger
+	// Table is the table applied versions are recorded in. The default is DefaultTable.
+	Table string
+}
+
+// Migration is a versioned migration. Up and Down may be empty, which makes that direction only record the version.
+type Migration struct {
+	Down    string
+	Name    string
+	Up      string
+	Version int64
+
+	hasDown bool
+}
+
+// Migrator applies and rolls back migrations.
+type Migrator struct {
+	migrations []Migration
+	options    Options
+	pool       *pgxpool.Pool
+}
+
+// New creates a Migrator and reads the migration files. It returns an error if a file name is malformed, a version is
+// duplicated, or a version has a down file but no up file.
+func New(pool *pgxpool.Pool, fsys fs.FS, options Options) (*Migrator, error) {
+	if options.Dir == "" {
+		options.Dir = "."
+	}
+	if options.LockID == 0 {
+		options.LockID = DefaultLockID
+	}
+	if options.Table == "" {
+		options.Table = DefaultTable
+	}
+	migrations, err := read(fsys, options.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	return &Migrator{
+		migrations: migrations,
+		options:    options,
+		pool:       pool,
+	}, nil
+}
+
+// Migrations returns the migrations in ascending order of version.
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration(nil), m.migrations...)
+}
+
+// Up applies every migration that has not been applied, in ascending order of version. Each migration runs in its own
+// transaction. It returns the number of migrations applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		versions, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if versions[migration.Version] {
+				continue
+			}
+			err = m.run(ctx, conn, migration, migration.Up, true)
+			if err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the most recently applied migrations, up to steps of them, in descending order of version.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(conn *pgxpool.Conn) error {
+		versions, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if !versions[migration.Version] {
+				continue
+			}
+			if !migration.hasDown {
+				return fmt.Errorf("migration %d %q has no down file", migration.Version, migration.Name)
+			}
+			err = m.run(ctx, conn, migration, migration.Down, false)
+			if err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Version returns the highest applied version, or zero if none are applied. It doesn't take the advisory lock, so it
+// doesn't wait for a running migration and may return the version from before it.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var exists bool
+	err := m.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", m.table()).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check for migrations table: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int64
+	err = m.pool.QueryRow(ctx, fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", m.table())).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query migration version: %w", err)
+	}
+	return version, nil
+}
+
+// Run runs a command from command-line arguments, for a CLI entry point: "up", "down" to roll back one migration,
+// "down N" to roll back N migrations, or "version". The number of migrations applied by "up" and the version from
+// "version" are written to w.
+func (m *Migrator) Run(ctx context.Context, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(`expected a migrate command: "up", "down [N]", or "version"`)
+	}
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, applied)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to roll back %q", args[1])
+			}
+		}
+		return m.Down(ctx, steps)
+	case "version":
+		version, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, version)
+		return err
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+func (m *Migrator) locked(ctx context.Context, f func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", m.options.LockID)
+	if err != nil {
+		return fmt.Errorf("failed to acquire advisory lock: %w", err)
+	}
+	defer func() {
+		// The lock is released with the session if the connection is broken, so a failure here is not fatal.
+		_, _ = conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", m.options.LockID)
+	}()
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT PRIMARY KEY,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, m.table()))
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	return f(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]bool, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT version FROM %s", m.table()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	applied := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
+
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, migration Migration, sql string, up bool) error {
+	direction := "down"
+	record := fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.table())
+	if up {
+		direction = "up"
+		record = fmt.Sprintf("INSERT INTO %s (version) VALUES ($1)", m.table())
+	}
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if strings.TrimSpace(sql) != "" {
+			_, err := tx.Exec(ctx, sql)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(ctx, record, migration.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s %d %q: %w", direction, migration.Version, migration.Name, err)
+	}
+	if m.options.Logger != nil {
+		m.options.Logger.InfoContext(ctx, "Migrated.",
+			"direction", direction,
+			"name", migration.Name,
+			"version", migration.Version,
+		)
+	}
+	return nil
+}
+
+func (m *Migrator) table() string {
+	return pgx.Identifier{m.options.Table}.Sanitize()
+}
+
+func read(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	byVersion := make(map[int64]*Migration)
+	// Files are tracked by version and direction instead of by content, because a file may be empty.
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("malformed migration file name %q", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid version in migration file name %q", entry.Name())
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %q: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{
+				Name:    match[2],
+				Version: version,
+			}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("version %d has migration files with different names %q and %q", version, migration.Name, match[2])
+		}
+		key := strconv.FormatInt(version, 10) + "." + match[3]
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate migration file %q", entry.Name())
+		}
+		seen[key] = true
+		if match[3] == "down" {
+			migration.Down = string(b)
+			migration.hasDown = true
+		} else {
+			migration.Up = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if !seen[strconv.FormatInt(migration.Version, 10)+".up"] {
+			return nil, fmt.Errorf("migration %d %q has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
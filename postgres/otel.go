@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+// TracerName is the name of the OpenTelemetry tracer of OTelTracer.
+const TracerName = "github.com/MicahParks/httphandle/postgres"
+
+// OTelTracer is a pgx.QueryTracer that creates an OpenTelemetry span for each query, a child of the span in the query's
+// context, such as the HTTP request span. The request UUID is added as an attribute. If TracerProvider is nil, the
+// global provider is used.
+type OTelTracer struct {
+	TracerProvider trace.TracerProvider
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (o OTelTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	provider := o.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", data.SQL),
+	}
+	reqUUID, ok := ctxkey.ReqUUIDFrom(ctx)
+	if ok {
+		attrs = append(attrs, attribute.String(middleware.FieldKeyReqUUID, reqUUID.String()))
+	}
+	ctx, _ = provider.Tracer(TracerName).Start(ctx, "postgres.query",
+		trace.WithAttributes(attrs...),
+		trace.WithSpanKind(trace.SpanKindClient),
+	)
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (o OTelTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// MultiTracer is a pgx.QueryTracer that calls every tracer, so tracers such as OTelTracer and QueryTracer can be
+// combined. Queries start in order and end in reverse order.
+type MultiTracer []pgx.QueryTracer
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (m MultiTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, t := range m {
+		ctx = t.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (m MultiTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i].TraceQueryEnd(ctx, conn, data)
+	}
+}
@@ -2,21 +2,55 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 
 	jt "github.com/MicahParks/jsontype"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
 )
 
 type Config struct {
-	DSN                   string                      `json:"dsn"`
-	Health                *jt.JSONType[time.Duration] `json:"health"`
-	InitialTimeout        *jt.JSONType[time.Duration] `json:"initialTimeout"`
+	DSN            string                      `json:"dsn"`
+	Health         *jt.JSONType[time.Duration] `json:"health"`
+	InitialTimeout *jt.JSONType[time.Duration] `json:"initialTimeout"`
+	// LazyConnect skips connecting when the pool is created, so the application can start while Postgres is down.
+	// Connections are made when first needed, and the retry settings are unused.
+	LazyConnect bool `json:"lazyConnect"`
+	LogQueries  bool `json:"logQueries"`
+	// MaxConns is the maximum size of the pool. The default is pgxpool's, the greater of 4 and the number of CPUs.
+	MaxConns              int32                       `json:"maxConns"`
 	MaxIdle               *jt.JSONType[time.Duration] `json:"maxIdle"`
 	MaxConnLifetime       *jt.JSONType[time.Duration] `json:"maxConnLifetime"`
 	MaxConnLifetimeJitter *jt.JSONType[time.Duration] `json:"maxConnLifetimeJitter"`
 	MinConns              int32                       `json:"minConns"`
+	ReplicaDSNs           []string                    `json:"replicaDSNs"`
+	// RetryAttempts is the number of attempts to connect. The default is 5, which fits in the default InitialTimeout.
+	// Retrying stops early if the next attempt would be after the deadline of the context passed to Pool.
+	RetryAttempts int `json:"retryAttempts"`
+	// RetryBackoff multiplies the delay after each failed attempt. The default is 2. Use 1 for a constant delay.
+	RetryBackoff float64 `json:"retryBackoff"`
+	// RetryDelay is the delay after the first failed attempt. The default is 500 milliseconds.
+	RetryDelay *jt.JSONType[time.Duration] `json:"retryDelay"`
+	// RetryJitter randomly changes each delay by up to this fraction of it, so replicas starting at once don't retry in
+	// lockstep. The default is 0.2.
+	RetryJitter *float64 `json:"retryJitter"`
+	// RetryMaxDelay caps the delay between attempts. The default is 30 seconds.
+	RetryMaxDelay *jt.JSONType[time.Duration] `json:"retryMaxDelay"`
+	// RuntimeParams are run-time parameters set on every connection, such as "application_name" or
+	// "statement_timeout". They override parameters in the DSN.
+	RuntimeParams map[string]string           `json:"runtimeParams"`
+	SlowQuery     *jt.JSONType[time.Duration] `json:"slowQuery"`
+	// Trace creates an OpenTelemetry span for each query with OTelTracer and the global tracer provider.
+	Trace bool `json:"trace"`
+	// Tracers are added after the tracers enabled by the configuration, such as the tracer of an inspector.Inspector.
+	// They can't be set in JSON.
+	Tracers []pgx.QueryTracer `json:"-"`
 }
 
 func (c Config) DefaultsAndValidate() (Config, error) {
@@ -38,8 +72,50 @@ func (c Config) DefaultsAndValidate() (Config, error) {
 	if c.MaxConnLifetimeJitter.Get() == 0 {
 		c.MaxConnLifetimeJitter = jt.New(5 * time.Minute)
 	}
+	if c.MaxConns < 0 {
+		return c, fmt.Errorf("%w: maxConns must not be negative", jt.ErrDefaultsAndValidate)
+	}
 	if c.MinConns == 0 {
 		c.MinConns = 2
+		if c.MaxConns != 0 {
+			c.MinConns = min(c.MinConns, c.MaxConns)
+		}
+	}
+	if c.MinConns < 0 {
+		return c, fmt.Errorf("%w: minConns must not be negative", jt.ErrDefaultsAndValidate)
+	}
+	if c.MaxConns != 0 && c.MinConns > c.MaxConns {
+		return c, fmt.Errorf("%w: minConns must not be greater than maxConns", jt.ErrDefaultsAndValidate)
+	}
+	for key := range c.RuntimeParams {
+		if key == "" {
+			return c, fmt.Errorf("%w: runtimeParams keys must not be empty", jt.ErrDefaultsAndValidate)
+		}
+	}
+	if c.RetryAttempts == 0 {
+		c.RetryAttempts = 5
+	}
+	if c.RetryAttempts < 0 {
+		return c, fmt.Errorf("%w: retryAttempts must be positive", jt.ErrDefaultsAndValidate)
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = 2
+	}
+	if c.RetryBackoff < 1 {
+		return c, fmt.Errorf("%w: retryBackoff must be at least 1", jt.ErrDefaultsAndValidate)
+	}
+	if c.RetryDelay.Get() == 0 {
+		c.RetryDelay = jt.New(500 * time.Millisecond)
+	}
+	if c.RetryJitter == nil {
+		jitter := 0.2
+		c.RetryJitter = &jitter
+	}
+	if *c.RetryJitter < 0 || *c.RetryJitter > 1 {
+		return c, fmt.Errorf("%w: retryJitter must be between 0 and 1", jt.ErrDefaultsAndValidate)
+	}
+	if c.RetryMaxDelay.Get() == 0 {
+		c.RetryMaxDelay = jt.New(30 * time.Second)
 	}
 	return c, nil
 }
@@ -54,29 +130,68 @@ func Pool(ctx context.Context, config Config) (*pgxpool.Pool, error) {
 	c.MaxConnLifetime = config.MaxConnLifetime.Get()
 	c.MaxConnLifetimeJitter = config.MaxConnLifetimeJitter.Get()
 	c.MinConns = config.MinConns
+	if config.MaxConns != 0 {
+		c.MaxConns = config.MaxConns
+	}
+	for key, value := range config.RuntimeParams {
+		c.ConnConfig.RuntimeParams[key] = value
+	}
+	var tracers MultiTracer
+	if config.Trace {
+		tracers = append(tracers, OTelTracer{})
+	}
+	if config.LogQueries || config.SlowQuery.Get() != 0 {
+		tracers = append(tracers, QueryTracer{
+			LogQueries: config.LogQueries,
+			SlowQuery:  config.SlowQuery.Get(),
+		})
+	}
+	tracers = append(tracers, config.Tracers...)
+	switch len(tracers) {
+	case 0:
+	case 1:
+		c.ConnConfig.Tracer = tracers[0]
+	default:
+		c.ConnConfig.Tracer = tracers
+	}
 
-	var conn *pgxpool.Pool
-	const retries = 5
-	for i := 0; i < retries; i++ {
-		conn, err = pgxpool.NewWithConfig(ctx, c)
+	l := ctxkey.LoggerFrom(ctx)
+	delay := config.RetryDelay.Get()
+	for attempt := 1; ; attempt++ {
+		pool, err := pgxpool.NewWithConfig(ctx, c)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create pool with given configuration: %w", err)
 		}
-		err = conn.Ping(ctx)
-		if err != nil {
-			select {
-			case <-ctx.Done():
-				return nil, fmt.Errorf("failed to connect to Postgres after waiting %d seconds: %w", retries, err)
-			case <-time.After(time.Second):
-			}
-			continue
+		if config.LazyConnect {
+			return pool, nil
+		}
+		err = pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+		pool.Close()
+		if attempt >= config.RetryAttempts {
+			return nil, fmt.Errorf("failed to connect to Postgres after %d attempts: %w", attempt, err)
 		}
-		break
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to create database connection: %w", err)
-	}
-
-	return conn, nil
 
+		wait := delay
+		if config.RetryJitter != nil && *config.RetryJitter != 0 {
+			wait += time.Duration((rand.Float64()*2 - 1) * *config.RetryJitter * float64(delay))
+		}
+		deadline, ok := ctx.Deadline()
+		if ok && time.Until(deadline) <= wait {
+			return nil, fmt.Errorf("failed to connect to Postgres after %d attempts before the deadline: %w", attempt, err)
+		}
+		l.WarnContext(ctx, "Failed to connect to Postgres. Retrying.",
+			constant.LogErr, err,
+			"attempt", attempt,
+			"wait", wait,
+		)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to connect to Postgres after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+		case <-time.After(wait):
+		}
+		delay = min(time.Duration(float64(delay)*config.RetryBackoff), config.RetryMaxDelay.Get())
+	}
 }
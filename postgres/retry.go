@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// SQLStateDeadlockDetected is the SQLSTATE of a deadlock.
+	SQLStateDeadlockDetected = "40P01"
+	// SQLStateSerializationFailure is the SQLSTATE of a serialization failure.
+	SQLStateSerializationFailure = "40001"
+)
+
+// RetryOptions are the options for RetryTx.
+type RetryOptions struct {
+	// Attempts is the number of attempts. The default is 3.
+	Attempts int
+	// Delay is the delay after the first failed attempt. It doubles after each attempt, with jitter. The default is 10
+	// milliseconds.
+	Delay time.Duration
+}
+
+// IsRetryable reports whether err is a serialization failure or a deadlock, after which the whole transaction can be
+// retried.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == SQLStateSerializationFailure || pgErr.Code == SQLStateDeadlockDetected
+}
+
+// RetryTx runs f in a transaction and commits it. If f or the commit fails with a serialization failure or deadlock,
+// the transaction is rolled back and retried in a new transaction with backoff. Other errors are returned without a
+// retry. f may run more than once, so it must not have side effects outside the transaction.
+//
+// A serialization failure aborts the whole transaction, so the transactional section of a handler using serializable
+// isolation should run in RetryTx with a *pgxpool.Pool's BeginTx method instead of in the request's transaction from
+// middleware.CreateAddTx.
+func RetryTx(ctx context.Context, begin func(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error), txOptions pgx.TxOptions, options RetryOptions, f func(ctx context.Context, tx pgx.Tx) error) error {
+	if options.Attempts <= 0 {
+		options.Attempts = 3
+	}
+	if options.Delay <= 0 {
+		options.Delay = 10 * time.Millisecond
+	}
+	delay := options.Delay
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, begin, txOptions, f)
+		if err == nil || !IsRetryable(err) || attempt >= options.Attempts {
+			return err
+		}
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to retry transaction after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+func runTx(ctx context.Context, begin func(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error), txOptions pgx.TxOptions, f func(ctx context.Context, tx pgx.Tx) error) error {
+	tx, err := begin(ctx, txOptions)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback(ctx)
+	err = f(ctx, tx)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+const (
+	// LogArgs is the log key for the arguments of a query.
+	LogArgs = "args"
+	// LogDuration is the log key for the duration of a query.
+	LogDuration = "duration"
+	// LogSQL is the log key for the SQL of a query.
+	LogSQL = "sql"
+	// Redacted replaces query arguments that may hold sensitive data.
+	Redacted = "[REDACTED]"
+)
+
+// QueryTracer is a pgx.QueryTracer that logs queries to the request's logger, or slog.Default if the query's context
+// has none.
+type QueryTracer struct {
+	// LogQueries logs every query with its arguments, duration, and error at the debug level.
+	LogQueries bool
+	// Redact, if not nil, replaces the arguments before they are logged. The default is RedactArgs.
+	Redact func(args []any) []any
+	// SlowQuery, if not zero, logs queries that take at least this long at the warn level.
+	SlowQuery time.Duration
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	args  []any
+	sql   string
+	start time.Time
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (q QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{
+		args:  data.Args,
+		sql:   data.SQL,
+		start: time.Now(),
+	})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (q QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	duration := time.Since(start.start)
+	slow := q.SlowQuery != 0 && duration >= q.SlowQuery
+	if !q.LogQueries && !slow {
+		return
+	}
+
+	l := ctxkey.LoggerFrom(ctx)
+	redact := q.Redact
+	if redact == nil {
+		redact = RedactArgs
+	}
+	attrs := []any{
+		LogArgs, redact(start.args),
+		LogDuration, duration,
+		LogSQL, start.sql,
+	}
+	if data.Err != nil {
+		attrs = append(attrs, constant.LogErr, data.Err)
+	}
+
+	if slow {
+		l.WarnContext(ctx, "Slow query.", attrs...)
+		return
+	}
+	l.DebugContext(ctx, "Query.", attrs...)
+}
+
+// RedactArgs replaces string and byte slice arguments with Redacted, because they may hold passwords, tokens, or
+// personal data. Other arguments, such as numbers, booleans, and times, are kept.
+func RedactArgs(args []any) []any {
+	redacted := make([]any, len(args))
+	for i, arg := range args {
+		switch arg.(type) {
+		case string, *string, []byte:
+			redacted[i] = Redacted
+		default:
+			redacted[i] = arg
+		}
+	}
+	return redacted
+}
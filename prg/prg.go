@@ -0,0 +1,223 @@
+// Package prg implements the Post-Redirect-Get pattern for form-handling template routes.
+//
+// A template handler calls Post from Respond when it receives a form submission. If the action reports field errors,
+// the submitted values and errors are stashed in a short-lived cookie and the browser is redirected back to the form.
+// The handler calls Get when rendering the form to re-populate the fields and show the errors. Fields that look
+// secret, such as passwords, are never stashed. Use PostOptions and GetOptions to omit other fields or sign the cookie.
+package prg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/MicahParks/httphandle"
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+)
+
+const (
+	// CookieName is the name of the cookie that holds the stashed form state.
+	CookieName = "hh_prg"
+	// maxCookieSize is the largest encoded cookie value. Submitted values are dropped if the state would be larger.
+	maxCookieSize = 3800
+)
+
+// SecretFields are substrings of field names whose values are never stashed, matched case-insensitively, so
+// passwords and card numbers from a failed submission don't end up in a cookie.
+var SecretFields = []string{"card", "cvc", "cvv", "passphrase", "passwd", "password", "secret", "ssn", "token"}
+
+// Options are the options for GetOptions and PostOptions. Use the same options for both.
+type Options struct {
+	// Key, if not nil, signs the cookie, so a stash that was changed on the client is ignored. It should be at least 32
+	// random bytes.
+	Key []byte
+	// Omit are the names of fields that are never stashed, in addition to those matching SecretFields.
+	Omit []string
+	// Secure sets the Secure attribute of the cookie.
+	Secure bool
+}
+
+// omit reports whether the field's value must not be stashed.
+func (o Options) omit(field string) bool {
+	if slices.Contains(o.Omit, field) {
+		return true
+	}
+	lower := strings.ToLower(field)
+	for _, secret := range SecretFields {
+		if strings.Contains(lower, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, o.Key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Action processes a submitted form. Field errors are keyed by form field name. If there are no field errors, the
+// browser is redirected to redirectURL, or back to the form if redirectURL is empty. A non-nil error results in an
+// internal server error.
+type Action func(r *http.Request, values url.Values) (fieldErrors map[string]string, redirectURL string, err error)
+
+// Form is the state of a form from a previous submission.
+type Form struct {
+	Errors map[string]string `json:"errors,omitempty"`
+	Values url.Values        `json:"values,omitempty"`
+}
+
+// Error returns the error for a field, if any.
+func (f Form) Error(field string) string {
+	return f.Errors[field]
+}
+
+// HasErrors reports whether the previous submission had any field errors.
+func (f Form) HasErrors() bool {
+	return len(f.Errors) > 0
+}
+
+// Value returns the submitted value for a field, if any.
+func (f Form) Value(field string) string {
+	return f.Values.Get(field)
+}
+
+// Get is GetOptions with the default options.
+func Get(r *http.Request) (Form, *http.Cookie) {
+	return GetOptions(r, Options{})
+}
+
+// GetOptions returns the form state stashed by a previous call to PostOptions. The returned cookie clears the stash and
+// should be added to TemplateRespMeta.Cookies. If nothing was stashed, or the stash's signature doesn't match, the Form
+// is empty.
+func GetOptions(r *http.Request, options Options) (Form, *http.Cookie) {
+	var form Form
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return form, nil
+	}
+	u := httphandle.OriginalURL(r)
+	clearCookie := &http.Cookie{
+		HttpOnly: true,
+		MaxAge:   -1,
+		Name:     CookieName,
+		Path:     u.Path,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   options.Secure,
+	}
+	payload, sig, _ := strings.Cut(cookie.Value, ".")
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return form, clearCookie
+	}
+	if options.Key != nil {
+		sig, err := base64.RawURLEncoding.DecodeString(sig)
+		if err != nil || !hmac.Equal(sig, options.sign(b)) {
+			return form, clearCookie
+		}
+	}
+	err = json.Unmarshal(b, &form)
+	if err != nil {
+		return Form{}, clearCookie
+	}
+	return form, clearCookie
+}
+
+// Post is PostOptions with the default options.
+func Post(r *http.Request, action Action) httphandle.TemplateRespMeta {
+	return PostOptions(r, action, Options{})
+}
+
+// PostOptions parses the submitted form, runs the action, and returns the TemplateRespMeta for the redirect. The
+// submitted values are stashed without the fields options omits.
+func PostOptions(r *http.Request, action Action, options Options) httphandle.TemplateRespMeta {
+	l := ctxkey.LoggerFrom(r.Context())
+
+	err := r.ParseForm()
+	if err != nil {
+		l.Info("Failed to parse form.",
+			constant.LogErr, err,
+		)
+		return httphandle.TemplateRespMeta{
+			ResponseCode: http.StatusBadRequest,
+		}
+	}
+
+	u := httphandle.OriginalURL(r)
+	fieldErrors, redirectURL, err := action(r, r.PostForm)
+	if err != nil {
+		l.Error("Failed to process form.",
+			constant.LogErr, err,
+		)
+		return httphandle.TemplateRespMeta{
+			ResponseCode: http.StatusInternalServerError,
+		}
+	}
+
+	if len(fieldErrors) == 0 {
+		if redirectURL == "" {
+			redirectURL = u.RequestURI()
+		}
+		return httphandle.TemplateRespMeta{
+			RedirectURL:  redirectURL,
+			ResponseCode: http.StatusSeeOther,
+		}
+	}
+
+	values := make(url.Values, len(r.PostForm))
+	for field, v := range r.PostForm {
+		if !options.omit(field) {
+			values[field] = v
+		}
+	}
+	form := Form{
+		Errors: fieldErrors,
+		Values: values,
+	}
+	value, err := options.encode(form)
+	if err != nil || len(value) > maxCookieSize {
+		form.Values = nil
+		value, err = options.encode(form)
+		if err != nil {
+			l.Error("Failed to encode form state.",
+				constant.LogErr, err,
+			)
+			return httphandle.TemplateRespMeta{
+				ResponseCode: http.StatusInternalServerError,
+			}
+		}
+	}
+	return httphandle.TemplateRespMeta{
+		Cookies: []*http.Cookie{{
+			HttpOnly: true,
+			MaxAge:   60,
+			Name:     CookieName,
+			Path:     u.Path,
+			SameSite: http.SameSiteLaxMode,
+			Secure:   options.Secure,
+			Value:    value,
+		}},
+		RedirectURL:  u.RequestURI(),
+		ResponseCode: http.StatusSeeOther,
+	}
+}
+
+// encode returns the cookie value of the form, signed like the consent cookie if options has a Key.
+func (o Options) encode(form Form) (string, error) {
+	b, err := json.Marshal(form)
+	if err != nil {
+		return "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(b)
+	if o.Key != nil {
+		value += "." + base64.RawURLEncoding.EncodeToString(o.sign(b))
+	}
+	return value, nil
+}
@@ -0,0 +1,161 @@
+package profiling
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+const (
+	contentTypeBinary = "application/octet-stream"
+	contentTypeText   = "text/plain; charset=utf-8"
+)
+
+// index serves the list of profiles or a named profile.
+func index(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name != "" {
+		profile(w, r, name)
+		return
+	}
+
+	profiles := pprof.Profiles()
+	b := &strings.Builder{}
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head><title>Profiles</title></head>\n<body>\n<ul>\n")
+	for _, p := range profiles {
+		name := html.EscapeString(p.Name())
+		_, _ = fmt.Fprintf(b, "<li><a href=\"%s?debug=1\">%s</a> (%d)</li>\n", name, name, p.Count())
+	}
+	b.WriteString("<li><a href=\"cmdline\">cmdline</a></li>\n")
+	b.WriteString("<li><a href=\"profile?seconds=30\">profile</a> (30 second CPU profile)</li>\n")
+	b.WriteString("<li><a href=\"trace?seconds=1\">trace</a> (1 second execution trace)</li>\n")
+	b.WriteString("</ul>\n</body>\n</html>\n")
+	w.Header().Set(constant.HeaderContentType, constant.ContentTypeHTML+"; charset=utf-8")
+	_, _ = io.WriteString(w, b.String())
+}
+
+// profile writes a named profile from runtime/pprof, such as "heap" or "goroutine". A non-zero debug query parameter
+// writes it as text. The gc query parameter runs a garbage collection before the heap profile.
+func profile(w http.ResponseWriter, r *http.Request, name string) {
+	ctx := r.Context()
+	p := pprof.Lookup(name)
+	if p == nil {
+		middleware.WriteErrorBody(ctx, http.StatusNotFound, "Unknown profile.", w)
+		return
+	}
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	gc, _ := strconv.Atoi(r.FormValue("gc"))
+	if name == "heap" && gc > 0 {
+		runtime.GC()
+	}
+
+	buf := &bytes.Buffer{}
+	err := p.WriteTo(buf, debug)
+	if err != nil {
+		middleware.WriteErrorBody(ctx, http.StatusInternalServerError, "Failed to write profile.", w)
+		return
+	}
+	if debug != 0 {
+		w.Header().Set(constant.HeaderContentType, contentTypeText)
+	} else {
+		w.Header().Set(constant.HeaderContentType, contentTypeBinary)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+// cmdline writes the command line of the process, with the arguments separated by NUL bytes.
+func cmdline(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set(constant.HeaderContentType, contentTypeText)
+	_, _ = io.WriteString(w, strings.Join(os.Args, "\x00"))
+}
+
+// cpuProfile writes a CPU profile of the number of seconds in the seconds query parameter, 30 by default.
+func cpuProfile(w http.ResponseWriter, r *http.Request) {
+	record(w, r, "profile", 30*time.Second, pprof.StartCPUProfile, pprof.StopCPUProfile)
+}
+
+// executionTrace writes an execution trace of the number of seconds in the seconds query parameter, 1 by default.
+func executionTrace(w http.ResponseWriter, r *http.Request) {
+	record(w, r, "trace", time.Second, trace.Start, trace.Stop)
+}
+
+func record(w http.ResponseWriter, r *http.Request, name string, defaultDuration time.Duration, start func(io.Writer) error, stop func()) {
+	ctx := r.Context()
+	duration := defaultDuration
+	seconds := r.FormValue("seconds")
+	if seconds != "" {
+		s, err := strconv.ParseFloat(seconds, 64)
+		if err != nil || s <= 0 {
+			middleware.WriteErrorBody(ctx, http.StatusBadRequest, "Invalid seconds.", w)
+			return
+		}
+		duration = time.Duration(s * float64(time.Second))
+	}
+
+	w.Header().Set(constant.HeaderContentType, contentTypeBinary)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	err := start(w)
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		middleware.WriteErrorBody(ctx, http.StatusInternalServerError, "Failed to start "+name+". It may already be running.", w)
+		return
+	}
+	sleep(ctx, duration)
+	stop()
+}
+
+func sleep(ctx context.Context, duration time.Duration) {
+	t := time.NewTimer(duration)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// symbol looks up the function names of program counters, for the pprof tool. The program counters are read from the
+// request body for POST requests and from the query for others, separated by plus signs.
+func symbol(w http.ResponseWriter, r *http.Request) {
+	var reader *bufio.Reader
+	if r.Method == http.MethodPost {
+		reader = bufio.NewReader(r.Body)
+	} else {
+		reader = bufio.NewReader(strings.NewReader(r.URL.RawQuery))
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("num_symbols: 1\n")
+	for {
+		word, err := reader.ReadSlice('+')
+		if err == nil {
+			word = word[:len(word)-1]
+		}
+		pc, _ := strconv.ParseUint(string(word), 0, 64)
+		if pc != 0 {
+			f := runtime.FuncForPC(uintptr(pc))
+			if f != nil {
+				_, _ = fmt.Fprintf(buf, "%#x %s\n", pc, f.Name())
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	w.Header().Set(constant.HeaderContentType, contentTypeText)
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,82 @@
+// Package profiling mounts pprof and expvar handlers through Attach, so they get the global middleware like any other
+// handler. The pprof handlers are built on runtime/pprof instead of net/http/pprof, so importing this package doesn't
+// add them to http.DefaultServeMux.
+package profiling
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"strings"
+
+	hh "github.com/MicahParks/httphandle"
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+// DefaultPrefix is the default URL prefix of the endpoints.
+const DefaultPrefix = "/debug"
+
+// Options are the options for the profiling endpoints.
+type Options struct {
+	// Middleware protects the endpoints, such as middleware.CreateBasicAuth or middleware.CreateIPFilter. It is applied
+	// in the order it is passed in and at least one is required, because profiles expose the internals of the process.
+	Middleware []middleware.Middleware
+	// Prefix is the URL prefix. The endpoints are Prefix+"/pprof/" and Prefix+"/vars". The default is DefaultPrefix.
+	Prefix string
+}
+
+// General creates the pprof and expvar handlers for AttachArgs.General. The CPU profile and trace endpoints skip the
+// request timeout, because they run for as long as the seconds query parameter asks.
+func General[A hh.AppSpecific](options Options) ([]hh.General[A], error) {
+	if len(options.Middleware) == 0 {
+		return nil, errors.New("profiling endpoints require protecting middleware")
+	}
+	prefix := strings.TrimSuffix(options.Prefix, "/")
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	endpoints := []endpoint[A]{
+		{handler: http.HandlerFunc(index), pattern: prefix + "/pprof/{name...}"},
+		{handler: http.HandlerFunc(cmdline), pattern: "GET " + prefix + "/pprof/cmdline"},
+		{handler: http.HandlerFunc(cpuProfile), long: true, pattern: "GET " + prefix + "/pprof/profile"},
+		{handler: http.HandlerFunc(symbol), pattern: prefix + "/pprof/symbol"},
+		{handler: http.HandlerFunc(executionTrace), long: true, pattern: "GET " + prefix + "/pprof/trace"},
+		{handler: expvar.Handler(), pattern: "GET " + prefix + "/vars"},
+	}
+	general := make([]hh.General[A], 0, len(endpoints))
+	for _, e := range endpoints {
+		e.middleware = options.Middleware
+		general = append(general, e)
+	}
+	return general, nil
+}
+
+type endpoint[A hh.AppSpecific] struct {
+	handler    http.Handler
+	long       bool
+	middleware []middleware.Middleware
+	pattern    string
+}
+
+func (e endpoint[A]) ApplyMiddleware(h http.Handler) http.Handler {
+	return middleware.Wrap(h, e.middleware...)
+}
+
+func (e endpoint[A]) GlobalPolicy(options middleware.GlobalOptions) middleware.GlobalOptions {
+	if e.long {
+		options.SkipReqTimeout = true
+	}
+	return options
+}
+
+func (e endpoint[A]) Initialize(A) error {
+	return nil
+}
+
+func (e endpoint[A]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.handler.ServeHTTP(w, r)
+}
+
+func (e endpoint[A]) URLPattern() string {
+	return e.pattern
+}
@@ -0,0 +1,44 @@
+package httphandle
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/MicahParks/templater"
+)
+
+// Renderer renders named templates for template handlers. Implement it to use a template engine other than
+// html/template, such as templ or quicktemplate, by mapping template names to components. The inner template and the
+// wrapper templates are rendered by name, so the TemplateDataResult passed to wrappers works with any engine.
+type Renderer interface {
+	// Lookup reports whether a template with the name exists.
+	Lookup(name string) bool
+	// Render executes the named template with data and writes the result to w.
+	Render(w io.Writer, name string, data any) error
+}
+
+// HTMLRenderer is a Renderer for an html/template template set.
+type HTMLRenderer struct {
+	Template *template.Template
+}
+
+// Lookup implements Renderer.
+func (h HTMLRenderer) Lookup(name string) bool {
+	return h.Template.Lookup(name) != nil
+}
+
+// Render implements Renderer.
+func (h HTMLRenderer) Render(w io.Writer, name string, data any) error {
+	return h.Template.ExecuteTemplate(w, name, data)
+}
+
+// renderer returns the Renderer for one response. Templates from a templater are fetched once per response, because
+// templaters that read from disk parse the templates on every call.
+func renderer(r Renderer, tmplr templater.Templater) Renderer {
+	if r != nil {
+		return r
+	}
+	return HTMLRenderer{
+		Template: tmplr.Tmpl(),
+	}
+}
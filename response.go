@@ -0,0 +1,30 @@
+package httphandle
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// goroutinePanic is a panic recovered in another goroutine, forwarded to the request's goroutine with the stack of the
+// goroutine it happened in.
+type goroutinePanic struct {
+	stack []byte
+	value any
+}
+
+func (g goroutinePanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", g.value, g.stack)
+}
+
+// recoverPanic captures the stack of a recovered panic so it can be forwarded to another goroutine. http.ErrAbortHandler
+// is returned as is, so it still aborts the response quietly.
+func recoverPanic(rec any) any {
+	if rec == nil || rec == http.ErrAbortHandler {
+		return rec
+	}
+	return goroutinePanic{
+		stack: debug.Stack(),
+		value: rec,
+	}
+}
@@ -0,0 +1,260 @@
+package httphandle
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/MicahParks/httphandle/api"
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+const (
+	// RouteTypeAPI is the Route type for API handlers.
+	RouteTypeAPI = "api"
+	// RouteTypeGeneral is the Route type for general handlers.
+	RouteTypeGeneral = "general"
+	// RouteTypeLiveReload is the Route type for the live reload endpoint.
+	RouteTypeLiveReload = "livereload"
+	// RouteTypePreflight is the Route type for CORS preflight routes.
+	RouteTypePreflight = "preflight"
+	// RouteTypeStatic is the Route type for static file systems.
+	RouteTypeStatic = "static"
+	// RouteTypeTemplate is the Route type for template handlers.
+	RouteTypeTemplate = "template"
+)
+
+const (
+	middlewareNameAddCtx               = "AddCtx"
+	middlewareNameApplyMiddleware      = "ApplyMiddleware"
+	middlewareNameApplyOuterMiddleware = "ApplyOuterMiddleware"
+	middlewareNameBulkhead             = "Bulkhead"
+	middlewareNameCORS                 = "CORS"
+	middlewareNameCacheControl         = "CacheControl"
+	middlewareNameDev                  = "DevMiddleware"
+	middlewareNameDevErrorPages        = "DevErrorPages"
+	middlewareNameGzip                 = "EncodeGzip"
+	middlewareNameLimitReqSize         = "LimitReqSize"
+	middlewareNameLiveReload           = "LiveReload"
+	middlewareNameMinifyHTML           = "MinifyHTML"
+	middlewareNameTxOptions            = "TxOptions"
+)
+
+// globalMiddlewareNames are the names of the middleware applied by middleware.ApplyGlobal, outermost first.
+var globalMiddlewareNames = []string{middlewareNameLimitReqSize, middlewareNameAddCtx, "RequestUUID", "AddLogger"}
+
+var routeTableTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Routes</title></head>
+<body>
+<table>
+<thead><tr><th>Host</th><th>Method</th><th>Pattern</th><th>Type</th><th>Request</th><th>Response</th><th>Middleware</th></tr></thead>
+<tbody>
+{{- range .}}
+<tr><td>{{.Host}}</td><td>{{.Method}}</td><td>{{.Pattern}}</td><td>{{.Type}}</td><td>{{.RequestContentType}}</td><td>{{.ResponseContentType}}</td><td>{{range $i, $m := .Middleware}}{{if $i}}, {{end}}{{$m}}{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// Route describes a route registered by Attach.
+type Route struct {
+	// Global are the options of the global middleware after GlobalPolicer. It is nil for routes without the global
+	// middleware, like the live reload endpoint.
+	Global *middleware.GlobalOptions `json:"global,omitempty"`
+	Host   string                    `json:"host,omitempty"`
+	Method string                    `json:"method,omitempty"`
+	// Middleware are the names of the middleware wrapping the handler, outermost first. Middleware added by a handler's
+	// ApplyMiddleware or ApplyOuterMiddleware method is opaque and is listed by the method name.
+	Middleware          []string `json:"middleware"`
+	Name                string   `json:"name,omitempty"`
+	Pattern             string   `json:"pattern"`
+	RequestContentType  string   `json:"requestContentType,omitempty"`
+	ResponseContentType string   `json:"responseContentType,omitempty"`
+	Type                string   `json:"type"`
+}
+
+// RouteTable is a list of routes populated by Attach. It is safe for concurrent use. It implements http.Handler to
+// render the routes as HTML if the client accepts it, otherwise as JSON.
+type RouteTable struct {
+	mux    sync.RWMutex
+	routes []Route
+}
+
+// Add adds a route to the table.
+func (t *RouteTable) Add(route Route) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.routes = append(t.routes, route)
+}
+
+// Routes returns a copy of the routes in the order they were registered.
+func (t *RouteTable) Routes() []Route {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	routes := make([]Route, len(t.routes))
+	copy(routes, t.routes)
+	return routes
+}
+
+// ServeHTTP implements http.Handler.
+func (t *RouteTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	routes := t.Routes()
+	if strings.Contains(r.Header.Get(constant.HeaderAccept), constant.ContentTypeHTML) {
+		w.Header().Set(constant.HeaderContentType, constant.ContentTypeHTML+"; charset=utf-8")
+		_ = routeTableTemplate.Execute(w, routes)
+		return
+	}
+	code, body, err := api.RespondJSON(r.Context(), http.StatusOK, routes)
+	if err != nil {
+		middleware.WriteErrorBody(r.Context(), http.StatusInternalServerError, constant.RespInternalServerError, w)
+		return
+	}
+	w.Header().Set(constant.HeaderContentType, constant.ContentTypeJSON)
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
+
+// Reverse builds the path of the route with the given name, as declared by a RouteNamer handler. Wildcards in the
+// pattern are replaced by the values in params, which are path escaped. A "{$}" wildcard is removed.
+func (t *RouteTable) Reverse(name string, params map[string]string) (string, error) {
+	t.mux.RLock()
+	idx := slices.IndexFunc(t.routes, func(route Route) bool {
+		return route.Name == name
+	})
+	var pattern string
+	if idx != -1 {
+		pattern = t.routes[idx].Pattern
+	}
+	t.mux.RUnlock()
+	if idx == -1 {
+		return "", fmt.Errorf("no route named %q", name)
+	}
+
+	path, err := fillPattern(pattern, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to reverse route %q: %w", name, err)
+	}
+	return path, nil
+}
+
+// FuncMap returns the "reverse" template function, which calls Reverse with a route name followed by pairs of parameter
+// names and values, such as {{reverse "user" "id" .ID}}. The table can be added to SetupArgs.FuncMap before Attach
+// populates it.
+func (t *RouteTable) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"reverse": func(name string, pairs ...any) (string, error) {
+			if len(pairs)%2 != 0 {
+				return "", fmt.Errorf("reverse for route %q needs pairs of parameter names and values", name)
+			}
+			params := make(map[string]string, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				params[fmt.Sprint(pairs[i])] = fmt.Sprint(pairs[i+1])
+			}
+			return t.Reverse(name, params)
+		},
+	}
+}
+
+// fillPattern replaces the wildcards in the path of a pattern with the path escaped params.
+func fillPattern(pattern string, params map[string]string) (string, error) {
+	p := parsePattern(pattern)
+	b := &strings.Builder{}
+	rest := p.path
+	for {
+		start := strings.Index(rest, "{")
+		if start == -1 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end == -1 {
+			return "", fmt.Errorf("malformed pattern %q", pattern)
+		}
+		end += start
+		b.WriteString(rest[:start])
+		wildcard := rest[start+1 : end]
+		rest = rest[end+1:]
+		if wildcard == "$" {
+			continue
+		}
+		key, multi := strings.CutSuffix(wildcard, "...")
+		value, ok := params[key]
+		if !ok {
+			return "", fmt.Errorf("missing parameter %q", key)
+		}
+		if !multi {
+			b.WriteString(url.PathEscape(value))
+			continue
+		}
+		segments := strings.Split(value, "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		b.WriteString(strings.Join(segments, "/"))
+	}
+	return b.String(), nil
+}
+
+func (t *RouteTable) add(route Route) {
+	if t == nil {
+		return
+	}
+	t.Add(route)
+}
+
+func routeName(handler any) string {
+	namer, ok := handler.(RouteNamer)
+	if !ok {
+		return ""
+	}
+	return namer.RouteName()
+}
+
+func policyMiddlewareNames(handler any) []string {
+	var names []string
+	_, ok := handler.(Bulkheader)
+	if ok {
+		names = append(names, middlewareNameBulkhead)
+	}
+	_, ok = handler.(CORSPolicer)
+	if ok {
+		names = append(names, middlewareNameCORS)
+	}
+	_, ok = handler.(CachePolicer)
+	if ok {
+		names = append(names, middlewareNameCacheControl)
+	}
+	_, ok = handler.(TxPolicer)
+	if ok {
+		names = append(names, middlewareNameTxOptions)
+	}
+	return names
+}
+
+func routeMiddleware(options middleware.GlobalOptions, handler any, names ...[]string) []string {
+	var all []string
+	_, ok := handler.(OuterMiddlewarer)
+	if ok {
+		all = append(all, middlewareNameApplyOuterMiddleware)
+	}
+	for _, name := range globalMiddlewareNames {
+		switch {
+		case name == middlewareNameLimitReqSize && options.SkipReqSizeLimit,
+			name == middlewareNameAddCtx && options.SkipReqTimeout:
+			continue
+		}
+		all = append(all, name)
+	}
+	for _, n := range names {
+		all = append(all, n...)
+	}
+	return all
+}
@@ -3,67 +3,401 @@ package httphandle
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"golang.org/x/crypto/acme/autocert"
+
 	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+const (
+	// DefaultDrainLogInterval is the default interval between drain progress logs during shutdown.
+	DefaultDrainLogInterval = time.Second
+	// DefaultIdleTimeout is the default time a keep-alive connection waits for the next request.
+	DefaultIdleTimeout = 2 * time.Minute
+	// DefaultMaxHeaderBytes is the default maximum size of request headers.
+	DefaultMaxHeaderBytes = http.DefaultMaxHeaderBytes
+	// DefaultReadHeaderTimeout is the default time allowed to read request headers.
+	DefaultReadHeaderTimeout = 5 * time.Second
+	// DefaultReadTimeout is the default time allowed to read a whole request, including the body.
+	DefaultReadTimeout = time.Minute
 )
 
+// AutoCertOptions are the options for serving HTTPS with certificates from Let's Encrypt.
+type AutoCertOptions struct {
+	// CacheDir is the directory certificates and the account key are stored in. It must persist across restarts to stay
+	// within the Let's Encrypt rate limits.
+	CacheDir string
+	// Domains are the host names certificates are requested for. Requests for other hosts are refused.
+	Domains []string
+	// Email is the optional contact address for the ACME account.
+	Email string
+	// HTTPRedirect runs a listener on port 80 that answers HTTP-01 challenges and redirects everything else to HTTPS. It
+	// is the same as setting ServeArgs.HTTPRedirectPort to 80.
+	HTTPRedirect bool
+}
+
+// TLSOptions are the options for serving HTTPS with a certificate and key from files.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+}
+
 // ServeArgs are the arguments for the Serve function.
 type ServeArgs struct {
-	Logger          *slog.Logger
-	Port            uint16
-	ShutdownFunc    func(ctx context.Context) error
+	// AutoCert, if not nil, serves HTTPS with certificates from Let's Encrypt. The TLS-ALPN challenge is answered on the
+	// HTTPS port. Port defaults to 443 in this mode.
+	AutoCert *AutoCertOptions
+	// BaseContext, if not nil, returns the base context of every request accepted on a listener. Use it for values the
+	// whole application needs before any middleware runs. See http.Server.BaseContext.
+	BaseContext func(listener net.Listener) context.Context
+	// ConnContext, if not nil, derives the context of every request on a new connection, such as to add per-connection
+	// or per-listener values. See http.Server.ConnContext.
+	ConnContext func(ctx context.Context, conn net.Conn) context.Context
+	// DrainLogInterval is the interval between logs of the number of in-flight requests while shutting down. The
+	// default is DefaultDrainLogInterval.
+	DrainLogInterval time.Duration
+	// HTTPRedirectPort, if not zero, runs a plain HTTP listener on this port that permanently redirects every request
+	// to HTTPS on Port. With AutoCert, it also answers HTTP-01 challenges. Both listeners are shut down together. It
+	// requires AutoCert or TLS.
+	HTTPRedirectPort uint16
+	// IdleTimeout is the time a keep-alive connection waits for the next request. The default is DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// Listener, if not nil, is served on instead of listening on Port. Use it for sockets with custom options, listeners
+	// from other networks, or ephemeral ports in tests. It is closed when the server shuts down.
+	Listener net.Listener
+	Logger   *slog.Logger
+	// MaxHeaderBytes is the maximum size of request headers. The default is DefaultMaxHeaderBytes.
+	MaxHeaderBytes int
+	// OnReady hooks run in order after the listeners are bound and the server is serving, such as to warm caches or
+	// announce readiness to a service registry. If one fails, the server shuts down and ServeContext returns the error.
+	OnReady []Hook
+	Port    uint16
+	// ReadHeaderTimeout is the time allowed to read request headers. The default is DefaultReadHeaderTimeout, which
+	// protects against slowloris attacks.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is the time allowed to read a whole request, including the body. The default is DefaultReadTimeout.
+	ReadTimeout time.Duration
+	// ShutdownFunc, if not nil, runs first during shutdown, before the server stops accepting requests. Use it to flip
+	// readiness with health.Checker.Shutdown.
+	ShutdownFunc func(ctx context.Context) error
+	// ShutdownHooks run in order after the server shuts down and the Supervisor stops, so they can close resources
+	// that requests and supervised goroutines use, like a database pool. Every hook runs even if an earlier one fails.
+	ShutdownHooks   []Hook
 	ShutdownTimeout time.Duration
+	// Signals are the signals that trigger shutdown. The default is SIGINT and SIGTERM.
+	Signals []os.Signal
+	// Routes, if not nil, are logged at startup so operators can confirm what was attached. Pass the same table as
+	// AttachArgs.Routes.
+	Routes *RouteTable
+	// Supervisor, if not nil, is stopped after the HTTP server shuts down.
+	Supervisor *Supervisor
+	// TLS, if not nil, serves HTTPS with the given certificate and key. Port defaults to 443 in this mode. It can't be
+	// used with AutoCert.
+	TLS *TLSOptions
+	// WriteTimeout is the time allowed to write a response, measured from the end of reading the request headers. The
+	// default is no limit, because it would cut off streaming responses like server-sent events. Handlers are still
+	// bounded by the request timeout of the global middleware.
+	WriteTimeout time.Duration
 }
 
-// Serve serves the http server and shuts it down gracefully.
-func Serve(args ServeArgs, handler http.Handler) {
+// HTTPServer creates the http.Server used by Serve, with the timeouts and limits set. A negative timeout disables it.
+func (args ServeArgs) HTTPServer(handler http.Handler) *http.Server {
 	srv := &http.Server{
-		Addr:    ":" + strconv.FormatUint(uint64(args.Port), 10),
-		Handler: handler,
+		Addr:              ":" + strconv.FormatUint(uint64(args.Port), 10),
+		BaseContext:       args.BaseContext,
+		ConnContext:       args.ConnContext,
+		Handler:           handler,
+		IdleTimeout:       timeoutOrDefault(args.IdleTimeout, DefaultIdleTimeout),
+		MaxHeaderBytes:    args.MaxHeaderBytes,
+		ReadHeaderTimeout: timeoutOrDefault(args.ReadHeaderTimeout, DefaultReadHeaderTimeout),
+		ReadTimeout:       timeoutOrDefault(args.ReadTimeout, DefaultReadTimeout),
+		WriteTimeout:      timeoutOrDefault(args.WriteTimeout, 0),
 	}
+	if srv.MaxHeaderBytes == 0 {
+		srv.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	return srv
+}
 
-	idleConnsClosed := make(chan struct{})
-	go serverShutdown(context.Background(), args, idleConnsClosed, srv)
-	err := srv.ListenAndServe()
-	if !errors.Is(err, http.ErrServerClosed) {
-		args.Logger.Info("Failed to listen and serve.",
+func timeoutOrDefault(timeout, defaultTimeout time.Duration) time.Duration {
+	switch {
+	case timeout < 0:
+		return 0
+	case timeout == 0:
+		return defaultTimeout
+	}
+	return timeout
+}
+
+// Serve serves the http server and shuts it down gracefully on one of ServeArgs.Signals. Errors are logged. Use
+// ServeContext to handle them instead.
+func Serve(args ServeArgs, handler http.Handler) {
+	err := ServeContext(context.Background(), args, handler)
+	if err != nil {
+		args.Logger.Error("Failed to serve.",
 			constant.LogErr, err,
 		)
 	}
+}
+
+// ServeContext serves the http server until ctx is done or the process receives one of ServeArgs.Signals, then shuts
+// it down gracefully. It returns the errors from listening and shutting down. A server closed by a shutdown isn't an
+// error.
+func ServeContext(ctx context.Context, args ServeArgs, handler http.Handler) error {
+	signals := args.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(ctx, signals...)
+	defer stop()
+
+	if args.AutoCert != nil && args.TLS != nil {
+		return errors.New("only one of AutoCert and TLS can be set")
+	}
+	if args.AutoCert != nil && args.AutoCert.HTTPRedirect && args.HTTPRedirectPort == 0 {
+		args.HTTPRedirectPort = 80
+	}
+	if args.HTTPRedirectPort != 0 && args.AutoCert == nil && args.TLS == nil {
+		return errors.New("HTTPRedirectPort requires AutoCert or TLS")
+	}
+	var certFile, keyFile string
+	switch {
+	case args.TLS != nil:
+		certFile, keyFile = args.TLS.CertFile, args.TLS.KeyFile
+		fallthrough
+	case args.AutoCert != nil:
+		if args.Port == 0 {
+			args.Port = 443
+		}
+	}
+	inFlight := &middleware.InFlight{}
+	srv := args.HTTPServer(inFlight.Middleware(handler))
+
+	// Buffered so the listeners never block if ServeContext already returned.
+	listenErr := make(chan error, 2)
+	var redirectSrv *http.Server
+	redirect := httpsRedirect(args.Port)
+	if args.AutoCert != nil {
+		manager := &autocert.Manager{
+			Cache:      autocert.DirCache(args.AutoCert.CacheDir),
+			Email:      args.AutoCert.Email,
+			HostPolicy: autocert.HostWhitelist(args.AutoCert.Domains...),
+			Prompt:     autocert.AcceptTOS,
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		redirect = manager.HTTPHandler(redirect)
+	}
+	if args.HTTPRedirectPort != 0 {
+		redirectArgs := args
+		redirectArgs.Port = args.HTTPRedirectPort
+		redirectSrv = redirectArgs.HTTPServer(redirect)
+	}
+
+	listener := args.Listener
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", srv.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %q: %w", srv.Addr, err)
+		}
+	}
+	if redirectSrv != nil {
+		redirectListener, err := net.Listen("tcp", redirectSrv.Addr)
+		if err != nil {
+			_ = listener.Close()
+			return fmt.Errorf("failed to listen on %q for HTTP redirect: %w", redirectSrv.Addr, err)
+		}
+		go func() {
+			err := redirectSrv.Serve(redirectListener)
+			if !errors.Is(err, http.ErrServerClosed) {
+				listenErr <- fmt.Errorf("failed to serve HTTP redirect listener: %w", err)
+			}
+		}()
+	}
 
+	logStartup(ctx, args, srv, listener)
+	go func() {
+		var err error
+		if args.AutoCert != nil || args.TLS != nil {
+			err = srv.ServeTLS(listener, certFile, keyFile)
+		} else {
+			err = srv.Serve(listener)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			listenErr <- fmt.Errorf("failed to serve: %w", err)
+		}
+	}()
+
+	for _, hook := range args.OnReady {
+		err := runHook(ctx, hook)
+		if err != nil {
+			err = fmt.Errorf("failed to run ready hook %q: %w", hook.Name, err)
+			return errors.Join(err, serverShutdown(args, srv, redirectSrv, inFlight))
+		}
+	}
+
+	var err error
 	select {
-	case <-time.After(args.ShutdownTimeout):
-		log.Print("Failed to close idle connections before timeout.")
-	case <-idleConnsClosed:
+	case <-ctx.Done():
+		args.Logger.InfoContext(ctx, "Context over.",
+			constant.LogErr, ctx.Err(),
+		)
+	case err = <-listenErr:
 	}
+	return errors.Join(err, serverShutdown(args, srv, redirectSrv, inFlight))
 }
 
-func serverShutdown(ctx context.Context, args ServeArgs, idleConnsClosed chan struct{}, srv *http.Server) {
-	<-ctx.Done()
-	args.Logger.InfoContext(ctx, "Context over.",
-		constant.LogErr, ctx.Err(),
+// httpsRedirect permanently redirects requests to the same host and URL over HTTPS on the given port.
+func httpsRedirect(port uint16) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = (&url.URL{Host: r.Host}).Hostname()
+		switch {
+		case port != 443:
+			u.Host = net.JoinHostPort(u.Host, strconv.FormatUint(uint64(port), 10))
+		case strings.Contains(u.Host, ":"):
+			u.Host = "[" + u.Host + "]"
+		}
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
+
+// logStartup logs the listen address, TLS mode, timeouts, and the attached routes with their global middleware
+// options.
+func logStartup(ctx context.Context, args ServeArgs, srv *http.Server, listener net.Listener) {
+	addr := listener.Addr().String()
+	tlsMode := "none"
+	switch {
+	case args.AutoCert != nil:
+		tlsMode = "autocert"
+	case args.TLS != nil:
+		tlsMode = "files"
+	}
+	attrs := []any{
+		"addr", addr,
+		"tls", tlsMode,
+		"idleTimeout", srv.IdleTimeout,
+		"maxHeaderBytes", srv.MaxHeaderBytes,
+		"readHeaderTimeout", srv.ReadHeaderTimeout,
+		"readTimeout", srv.ReadTimeout,
+		"writeTimeout", srv.WriteTimeout,
+		"shutdownTimeout", args.ShutdownTimeout,
+	}
+	if args.HTTPRedirectPort != 0 {
+		attrs = append(attrs, "httpRedirectPort", args.HTTPRedirectPort)
+	}
+	if args.Routes != nil {
+		routes := args.Routes.Routes()
+		attrs = append(attrs, "routes", len(routes))
+		for _, route := range routes {
+			routeAttrs := []any{
+				"host", route.Host,
+				"method", route.Method,
+				"middleware", route.Middleware,
+				"pattern", route.Pattern,
+				"type", route.Type,
+			}
+			if route.Global != nil {
+				routeAttrs = append(routeAttrs, slog.Group("global",
+					"maxReqSize", route.Global.MaxReqSize,
+					"reqTimeout", route.Global.ReqTimeout,
+					"skipReqSizeLimit", route.Global.SkipReqSizeLimit,
+					"skipReqTimeout", route.Global.SkipReqTimeout,
+				))
+			}
+			args.Logger.InfoContext(ctx, "Route attached.", routeAttrs...)
+		}
+	}
+	args.Logger.InfoContext(ctx, "Serving.", attrs...)
+}
+
+// drain stops accepting new connections and waits for in-flight requests, logging their number at
+// ServeArgs.DrainLogInterval. Connections still open when ctx is done are forcibly closed.
+func drain(ctx context.Context, args ServeArgs, srv *http.Server, inFlight *middleware.InFlight) error {
+	args.Logger.InfoContext(ctx, "Draining in-flight requests.",
+		constant.LogInFlight, inFlight.Count(),
 	)
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Shutdown(ctx)
+	}()
+	interval := args.DrainLogInterval
+	if interval <= 0 {
+		interval = DefaultDrainLogInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				return nil
+			}
+			args.Logger.WarnContext(ctx, "Forcibly closing connections that didn't drain before time ended.",
+				constant.LogInFlight, inFlight.Count(),
+			)
+			return errors.Join(
+				fmt.Errorf("couldn't shut down HTTP server before time ended: %w", err),
+				srv.Close(),
+			)
+		case <-ticker.C:
+			args.Logger.InfoContext(ctx, "Waiting for in-flight requests.",
+				constant.LogInFlight, inFlight.Count(),
+			)
+		}
+	}
+}
 
+func serverShutdown(args ServeArgs, srv, redirectSrv *http.Server, inFlight *middleware.InFlight) error {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), args.ShutdownTimeout)
-	err := args.ShutdownFunc(shutdownCtx)
-	if err != nil {
-		args.Logger.ErrorContext(ctx, "Failed to run provided shutdown function.",
-			constant.LogErr, err,
-		)
+	defer cancel()
+
+	var errs []error
+	if args.ShutdownFunc != nil {
+		err := args.ShutdownFunc(shutdownCtx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to run provided shutdown function: %w", err))
+		}
 	}
 
-	defer cancel()
-	err = srv.Shutdown(shutdownCtx)
+	err := drain(shutdownCtx, args, srv, inFlight)
 	if err != nil {
-		args.Logger.ErrorContext(ctx, "Couldn't shut down HTTP server before time ended.",
-			constant.LogErr, err,
-		)
+		errs = append(errs, err)
+	}
+
+	if redirectSrv != nil {
+		err = redirectSrv.Shutdown(shutdownCtx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't shut down HTTP redirect server before time ended: %w", err))
+		}
+	}
+
+	if args.Supervisor != nil {
+		err = args.Supervisor.Stop(shutdownCtx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop supervised goroutines: %w", err))
+		}
+	}
+
+	for _, hook := range args.ShutdownHooks {
+		err = runHook(shutdownCtx, hook)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to run shutdown hook %q: %w", hook.Name, err))
+		}
 	}
 
-	close(idleConnsClosed)
+	return errors.Join(errs...)
 }
@@ -1,82 +1,379 @@
 package httphandle
 
 import (
-	"embed"
+	"context"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	jt "github.com/MicahParks/jsontype"
 	"github.com/MicahParks/templater"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/health"
+	"github.com/MicahParks/httphandle/livereload"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
+	"github.com/MicahParks/httphandle/postgres"
+	"github.com/MicahParks/httphandle/postgres/migrate"
 )
 
 // DevDecider is a jsontype.Config that determines if the application is in development mode.
+// Development mode is always off in binaries built with the httphandle_prod build tag.
 type DevDecider interface {
 	DevMode() bool
 }
 
+// DefaultMigrationsTimeout is the default of SetupArgs.MigrationsTimeout.
+const DefaultMigrationsTimeout = 5 * time.Minute
+
+const (
+	// LogFormatJSON writes logs with slog.JSONHandler.
+	LogFormatJSON = "json"
+	// LogFormatText writes logs with slog.TextHandler. It is the default.
+	LogFormatText = "text"
+)
+
+// LogOptions configure the logger created by Setup.
+type LogOptions struct {
+	// Attrs are added to every log record, such as the service name, version, and environment.
+	Attrs []slog.Attr
+	// Format is LogFormatText or LogFormatJSON. The default is LogFormatText.
+	Format string
+	// Handler, if not nil, is used instead of a handler created from Format, Output, and TimeFormat. Attrs are still
+	// added, but it decides its own level, so SetupResults.LogLevel has no effect.
+	Handler slog.Handler
+	// Output is where logs are written. The default is os.Stdout.
+	Output io.Writer
+	// TimeFormat, if not empty, is the time.Format layout of the time of each record.
+	TimeFormat string
+}
+
+// LevelDecider is a jsontype.Config that sets the log level. Without it, the level is debug in development mode and
+// info otherwise. A slog.Level field can be unmarshalled from JSON strings like "warn".
+type LevelDecider interface {
+	LogLevel() slog.Level
+}
+
+// PostgresConfigurer is a jsontype.Config that configures a Postgres pool. If the configuration implements it, Setup
+// creates the pool and its read replica pools, retrying until postgres.Config.InitialTimeout, and adds a "postgres"
+// check to the health Checker, plus a "postgres-replica-N" check for each replica.
+type PostgresConfigurer interface {
+	PostgresConfig() postgres.Config
+}
+
 // SetupArgs are the arguments for setting up the application.
 type SetupArgs struct {
-	Static    embed.FS
-	Templates embed.FS
+	// Config layers environment variables and command-line flags over the JSON configuration.
+	Config ConfigOptions
+	// DevStaticDir is the directory on disk static files are served from in development mode. The default is StaticDir.
+	DevStaticDir string
+	// DevTemplatesDir is the directory on disk templates are parsed from in development mode. The default is
+	// TemplatesDir.
+	DevTemplatesDir string
+	// FuncMap is added to the templates before they are parsed.
+	FuncMap template.FuncMap
+	// Log configures the logger. The level is debug in development mode and info otherwise, unless the configuration
+	// implements LevelDecider.
+	Log LogOptions
+	// Migrations, if not nil, holds SQL migration files in the format of the migrate package. They are applied with
+	// migrate.Migrator.Up after the Postgres pool is created. It requires the configuration to implement
+	// PostgresConfigurer.
+	Migrations fs.FS
+	// MigrationsTimeout limits how long applying Migrations may take, including waiting for another instance that holds
+	// the migration lock. The default is DefaultMigrationsTimeout.
+	MigrationsTimeout time.Duration
+	// OnConfigLoaded hooks run in order after the configuration is loaded and validated, before anything is created
+	// from it. Setup stops at the first hook that fails.
+	OnConfigLoaded []ConfigHook
+	// ReloadLogLevel re-reads the configuration on SIGHUP and sets SetupResults.LogLevel from it, if it implements
+	// LevelDecider. Other configuration changes are ignored.
+	ReloadLogLevel bool
+	// Static holds the static files served outside development mode, such as an embed.FS, os.DirFS, or
+	// fstest.MapFS.
+	Static fs.FS
+	// StaticDir is the directory of Static that static files are served from. The default is constant.StaticDir.
+	StaticDir string
+	// Templates holds the templates parsed outside development mode, such as an embed.FS, os.DirFS, or fstest.MapFS.
+	Templates fs.FS
+	// TemplatesDir is the directory of Templates that templates are parsed from. The default is
+	// constant.TemplatesDir.
+	TemplatesDir string
+	// TemplatesPattern is the glob pattern of template files in the templates directory. The default is
+	// constant.TemplatesPattern.
+	TemplatesPattern string
+}
+
+func (args SetupArgs) withDefaults() SetupArgs {
+	if args.StaticDir == "" {
+		args.StaticDir = constant.StaticDir
+	}
+	if args.TemplatesDir == "" {
+		args.TemplatesDir = constant.TemplatesDir
+	}
+	if args.TemplatesPattern == "" {
+		args.TemplatesPattern = constant.TemplatesPattern
+	}
+	if args.DevStaticDir == "" {
+		args.DevStaticDir = args.StaticDir
+	}
+	if args.DevTemplatesDir == "" {
+		args.DevTemplatesDir = args.TemplatesDir
+	}
+	if args.MigrationsTimeout <= 0 {
+		args.MigrationsTimeout = DefaultMigrationsTimeout
+	}
+	return args
 }
 
 // SetupResults are the results of setting up the application.
 type SetupResults[C jt.Defaulter[C]] struct {
-	Conf      C
-	Files     http.FileSystem
-	Logger    *slog.Logger
-	Templater templater.Templater
+	Conf C
+	// ConfigSources maps the JSON key of every top-level configuration field to the source that set it, such as
+	// ConfigSourceEnv.
+	ConfigSources map[string]string
+	// DevMode is true if the configuration is in development mode. Pass it to AttachArgs to enable DevMiddleware.
+	DevMode bool
+	Files   http.FileSystem
+	// Health is a Checker with the checks of the resources Setup created, such as the Postgres pool. Serve its
+	// Readiness and Liveness handlers and add the application's own checks to it.
+	Health *health.Checker
+	// LiveReload is only set in development mode. Pass it to AttachArgs to enable browser live reload.
+	LiveReload *livereload.Reloader
+	// LogLevel is the level of Logger. Change it at runtime with LevelHandler or SIGHUP.
+	LogLevel *slog.LevelVar
+	Logger   *slog.Logger
+	// Postgres is only set if the configuration implements PostgresConfigurer. It is the primary pool of
+	// PostgresCluster. Close it on shutdown.
+	Postgres *pgxpool.Pool
+	// PostgresCluster is set with Postgres. It holds the read replica pools of postgres.Config.ReplicaDSNs, if any. Pass
+	// its BeginTx method to middleware.CreateAddTxOptions to route read-only transactions to the replicas.
+	PostgresCluster *postgres.Cluster
+	Templater       templater.Templater
+
+	closers []func(ctx context.Context) error
 }
 
-// Setup sets up the application.
-func Setup[C jt.Defaulter[C]](args SetupArgs) (SetupResults[C], error) {
-	var r SetupResults[C]
+// Setup sets up the application. If it fails, everything it created is closed.
+func Setup[C jt.Defaulter[C]](args SetupArgs) (r SetupResults[C], err error) {
+	args = args.withDefaults()
+	defer func() {
+		if err == nil {
+			return
+		}
+		closeErr := r.Close(context.Background())
+		if closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close after failed setup: %w", closeErr))
+		}
+		r.closers = nil
+	}()
 
-	conf, err := jt.Read[C]()
+	conf, sources, err := readConfig[C](args.Config)
 	if err != nil {
 		return r, fmt.Errorf("failed to read configuration: %w", err)
 	}
 	r.Conf = conf
+	r.ConfigSources = sources
+
+	for _, hook := range args.OnConfigLoaded {
+		err = runConfigHook(context.Background(), hook, conf)
+		if err != nil {
+			return r, fmt.Errorf("failed to run config loaded hook %q: %w", hook.Name, err)
+		}
+	}
 
 	devMode := true
 	d, ok := any(conf).(DevDecider)
 	if ok {
 		devMode = d.DevMode()
 	}
+	devMode = devMode && devBuild
+	r.DevMode = devMode
 
-	var logger *slog.Logger
 	var tmplr templater.Templater
 	var files http.FileSystem
-	logLevel := slog.LevelInfo
-	if devMode {
-		logLevel = slog.LevelDebug
+	r.LogLevel = &slog.LevelVar{}
+	r.LogLevel.Set(logLevel(conf, devMode))
+	logger, err := newLogger(args.Log, r.LogLevel)
+	if err != nil {
+		return r, fmt.Errorf("failed to create logger: %w", err)
+	}
+	closer, ok := args.Log.Output.(io.Closer)
+	if ok && args.Log.Handler == nil && args.Log.Output != os.Stdout && args.Log.Output != os.Stderr {
+		r.closers = append(r.closers, func(context.Context) error {
+			return closer.Close()
+		})
+	}
+	if args.ReloadLogLevel {
+		r.closers = append(r.closers, reloadLevelOnSIGHUP[C](args.Config, r.LogLevel, devMode, logger))
 	}
-	logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: logLevel,
-	}))
 	if devMode {
-		tmplr = templater.NewDiskTemplater("templates", nil, "*.gohtml", "")
-		files = http.Dir(constant.StaticDir)
+		tmplr = templater.NewDiskTemplater(args.DevTemplatesDir, args.FuncMap, args.TemplatesPattern, "")
+		files = http.Dir(args.DevStaticDir)
+		r.LiveReload = livereload.New(livereload.Options{
+			Dirs:             []string{args.DevTemplatesDir, args.DevStaticDir},
+			Logger:           logger,
+			TemplatesDir:     args.DevTemplatesDir,
+			TemplatesPattern: args.TemplatesPattern,
+			Validate: func() error {
+				_, err := template.New("").Funcs(args.FuncMap).ParseFS(os.DirFS(args.DevTemplatesDir), args.TemplatesPattern)
+				return err
+			},
+		})
 	} else {
-		tmplr, err = templater.NewEmbeddedTemplater("templates", args.Templates, nil, "*.gohtml", "")
+		if args.Templates == nil || args.Static == nil {
+			return r, errors.New("templates and static file systems are required outside development mode")
+		}
+		tmplr, err = newFSTemplater(args.Templates, args.TemplatesDir, args.TemplatesPattern, args.FuncMap)
 		if err != nil {
-			return r, fmt.Errorf("failed to create embedded templater: %w", err)
+			return r, fmt.Errorf("failed to create templater: %w", err)
 		}
-		sub, err := fs.Sub(args.Static, constant.StaticDir)
+		sub, err := fs.Sub(args.Static, args.StaticDir)
 		if err != nil {
-			return r, fmt.Errorf("failed to create embedded static file system: %w", err)
+			return r, fmt.Errorf("failed to create static file system: %w", err)
 		}
 		files = http.FS(sub)
 	}
 
+	if r.LiveReload != nil {
+		reloader := r.LiveReload
+		r.closers = append(r.closers, func(context.Context) error {
+			reloader.Close()
+			return nil
+		})
+	}
 	r.Files = files
+	r.Health = health.New(health.Options{})
 	r.Logger = logger
 	r.Templater = tmplr
 
+	pc, ok := any(conf).(PostgresConfigurer)
+	if !ok && args.Migrations != nil {
+		return r, errors.New("migrations require the configuration to implement PostgresConfigurer")
+	}
+	if ok {
+		pgConf, err := pc.PostgresConfig().DefaultsAndValidate()
+		if err != nil {
+			return r, fmt.Errorf("failed to apply defaults and validate Postgres configuration: %w", err)
+		}
+		ctx := context.WithValue(context.Background(), ctxkey.Logger, logger)
+		ctx, cancel := context.WithTimeout(ctx, pgConf.InitialTimeout.Get())
+		defer cancel()
+		cluster, err := postgres.NewCluster(ctx, pgConf)
+		if err != nil {
+			return r, fmt.Errorf("failed to create Postgres pool: %w", err)
+		}
+		r.closers = append(r.closers, func(context.Context) error {
+			cluster.Close()
+			return nil
+		})
+		pool := cluster.Primary
+		if args.Migrations != nil {
+			m, err := migrate.New(pool, args.Migrations, migrate.Options{
+				Logger: logger,
+			})
+			if err != nil {
+				return r, fmt.Errorf("failed to create migrator: %w", err)
+			}
+			migrateCtx, migrateCancel := context.WithTimeout(context.WithoutCancel(ctx), args.MigrationsTimeout)
+			_, err = m.Up(migrateCtx)
+			migrateCancel()
+			if err != nil {
+				return r, fmt.Errorf("failed to apply migrations: %w", err)
+			}
+		}
+		r.Health.Add("postgres", postgres.HealthCheck(pool))
+		for i, replica := range cluster.Replicas {
+			r.Health.Add(fmt.Sprintf("postgres-replica-%d", i), postgres.HealthCheck(replica))
+		}
+		r.Postgres = pool
+		r.PostgresCluster = cluster
+	}
+
 	return r, nil
 }
+
+// Close releases everything Setup created, in the reverse order of creation: the Postgres pools, the live reload
+// watcher, the SIGHUP log level reloader, and the log output if it is an io.Closer other than os.Stdout and
+// os.Stderr. Every resource is closed even if one fails. It can be passed as ServeArgs.ShutdownFunc, or as the Func of
+// a ServeArgs.ShutdownHooks entry to close the resources after in-flight requests drain.
+func (r SetupResults[C]) Close(ctx context.Context) error {
+	var errs []error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		errs = append(errs, r.closers[i](ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// fsTemplater is a templater.Templater for templates parsed once from an fs.FS.
+type fsTemplater struct {
+	tmpl *template.Template
+}
+
+func newFSTemplater(fsys fs.FS, dir, pattern string, funcMap template.FuncMap) (fsTemplater, error) {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return fsTemplater{}, fmt.Errorf("failed to get templates directory: %w", err)
+	}
+	tmpl, err := template.New("").Funcs(funcMap).ParseFS(sub, pattern)
+	if err != nil {
+		return fsTemplater{}, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	return fsTemplater{
+		tmpl: tmpl,
+	}, nil
+}
+
+func (f fsTemplater) Tmpl() *template.Template {
+	return f.tmpl
+}
+
+func logLevel(conf any, devMode bool) slog.Level {
+	ld, ok := conf.(LevelDecider)
+	if ok {
+		return ld.LogLevel()
+	}
+	if devMode {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+func newLogger(options LogOptions, level slog.Leveler) (*slog.Logger, error) {
+	h := options.Handler
+	if h == nil {
+		handlerOptions := &slog.HandlerOptions{
+			Level: level,
+		}
+		if options.TimeFormat != "" {
+			handlerOptions.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && a.Key == slog.TimeKey && a.Value.Kind() == slog.KindTime {
+					a.Value = slog.StringValue(a.Value.Time().Format(options.TimeFormat))
+				}
+				return a
+			}
+		}
+		output := options.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		switch options.Format {
+		case "", LogFormatText:
+			h = slog.NewTextHandler(output, handlerOptions)
+		case LogFormatJSON:
+			h = slog.NewJSONHandler(output, handlerOptions)
+		default:
+			return nil, fmt.Errorf("unknown log format %q", options.Format)
+		}
+	}
+	if len(options.Attrs) != 0 {
+		h = h.WithAttrs(options.Attrs)
+	}
+	return slog.New(h), nil
+}
@@ -0,0 +1,84 @@
+package httphandle
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/MicahParks/httphandle/middleware"
+)
+
+// DefaultStaticIndex is the default file served for a directory by a Static entry.
+const DefaultStaticIndex = "index.html"
+
+// Static serves a file system under a path, independently of the index template handler.
+type Static struct {
+	// CacheControl is the Cache-Control policy for the files. The default is middleware.CacheDefaults.
+	CacheControl *middleware.CacheControlOptions
+	// DirectoryListing lists the contents of directories that have no index file. Directories are not found otherwise.
+	DirectoryListing bool
+	Files            http.FileSystem
+	// Index is the file served for a directory. The default is DefaultStaticIndex.
+	Index string
+	// Path is the path the files are mounted at, such as "/assets/".
+	Path string
+}
+
+func createStaticHandler[A AppSpecific](a A, static Static) http.Handler {
+	cacheOptions := middleware.CacheDefaults
+	if static.CacheControl != nil {
+		cacheOptions = *static.CacheControl
+	}
+	index := static.Index
+	if index == "" {
+		index = DefaultStaticIndex
+	}
+	cacheControl := middleware.CreateCacheControl(cacheOptions)
+	fileServer := cacheControl(middleware.EncodeGzip(http.FileServer(static.Files)))
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := static.Files.Open(r.URL.Path)
+		if err != nil {
+			a.NotFound(w, r)
+			return
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			a.NotFound(w, r)
+			return
+		}
+		if !info.IsDir() || !strings.HasSuffix(r.URL.Path, "/") {
+			// The file server redirects directories to their path with a trailing slash.
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+
+		indexFile, err := static.Files.Open(path.Join(r.URL.Path, index))
+		if err == nil {
+			//goland:noinspection GoUnhandledErrorResult
+			defer indexFile.Close()
+			indexInfo, err := indexFile.Stat()
+			if err == nil && !indexInfo.IsDir() {
+				cacheControl(middleware.EncodeGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					http.ServeContent(w, r, indexInfo.Name(), indexInfo.ModTime(), indexFile)
+				}))).ServeHTTP(w, r)
+				return
+			}
+		}
+		if !static.DirectoryListing {
+			a.NotFound(w, r)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+	return http.StripPrefix(strings.TrimSuffix(static.Path, "/"), h)
+}
+
+func staticPattern(static Static) string {
+	p := static.Path
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return http.MethodGet + " " + p
+}
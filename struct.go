@@ -3,14 +3,19 @@ package httphandle
 import (
 	"html/template"
 	"net/http"
+	"net/url"
 
 	"github.com/google/uuid"
+
+	"github.com/MicahParks/httphandle/middleware"
+	"github.com/MicahParks/httphandle/middleware/ctxkey"
 )
 
 // TemplateDataResult is the result of executing a template, used for the wrapper template.
 type TemplateDataResult struct {
 	HeaderAdd    template.HTML
 	InnerHTML    template.HTML
+	RequestData  RequestData
 	RequestUUID  uuid.UUID
 	TemplateArgs TemplateArgs
 }
@@ -23,17 +28,48 @@ type TemplateArgs struct {
 	ResponseCode int
 	WrapperData  WrapperData
 	WrapperName  string
+	// WrapperNames is an ordered list of wrapper templates, from innermost to outermost. Each wrapper receives the
+	// previous layer's rendered HTML as TemplateDataResult.InnerHTML. If empty, WrapperName is the only wrapper.
+	WrapperNames []string
 	Writer       http.ResponseWriter
 }
 
-// RequestData is the data passed to the template.
+// RequestData is the data passed to the template. It is derived from the request by the framework.
 type RequestData struct {
-	Query map[string]string
+	// Identity is the authenticated identity of the request, or nil if it is not authenticated.
+	Identity    *middleware.Identity
+	Query       map[string]string
+	RequestUUID uuid.UUID
+	URL         *url.URL
+}
+
+// NewRequestData creates the RequestData for a request. Only the first value of each query parameter is kept.
+func NewRequestData(r *http.Request) RequestData {
+	query := r.URL.Query()
+	q := make(map[string]string, len(query))
+	for key := range query {
+		q[key] = query.Get(key)
+	}
+	reqUUID, _ := ctxkey.ReqUUIDFrom(r.Context())
+	var identity *middleware.Identity
+	i, ok := middleware.IdentityFrom(r.Context())
+	if ok {
+		identity = &i
+	}
+	return RequestData{
+		Identity:    identity,
+		Query:       q,
+		RequestUUID: reqUUID,
+		URL:         r.URL,
+	}
 }
 
 // TemplateRespMeta is the metadata returned from the template.
 type TemplateRespMeta struct {
-	Cookies      []*http.Cookie
+	Cookies []*http.Cookie
+	// Header values replace any existing values for the same keys. They are applied before Cookies, so Set-Cookie
+	// values from both are kept.
+	Header       http.Header
 	RedirectURL  string
 	ResponseCode int
 }
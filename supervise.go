@@ -0,0 +1,221 @@
+package httphandle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/httphandle/constant"
+	"github.com/MicahParks/httphandle/health"
+)
+
+const (
+	// DefaultMaxBackoff is the default maximum delay between restarts of a supervised goroutine.
+	DefaultMaxBackoff = time.Minute
+	// DefaultMinBackoff is the default initial delay between restarts of a supervised goroutine.
+	DefaultMinBackoff = time.Second
+)
+
+// RestartPolicy decides when a supervised goroutine is restarted.
+type RestartPolicy int
+
+const (
+	// RestartOnFailure restarts the goroutine when it returns an error or panics.
+	RestartOnFailure RestartPolicy = iota
+	// RestartAlways restarts the goroutine whenever it returns before the context is done.
+	RestartAlways
+	// RestartNever runs the goroutine once.
+	RestartNever
+)
+
+// GoOptions are the options for a supervised goroutine.
+type GoOptions struct {
+	MaxBackoff time.Duration
+	// MaxRestarts limits the number of restarts. Zero means no limit.
+	MaxRestarts int
+	MinBackoff  time.Duration
+	Restart     RestartPolicy
+}
+
+// TaskStatus is the status of a supervised goroutine.
+type TaskStatus struct {
+	// GaveUp means the goroutine failed and won't be restarted, because its RestartPolicy is RestartNever or it used
+	// up GoOptions.MaxRestarts.
+	GaveUp    bool      `json:"gaveUp,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	LastStart time.Time `json:"lastStart"`
+	Name      string    `json:"name"`
+	Restarts  int       `json:"restarts"`
+	Running   bool      `json:"running"`
+}
+
+// Supervisor runs goroutines whose lifetime is bound to a context. Panics are recovered and goroutines are restarted
+// with jittered exponential backoff according to their RestartPolicy. Pass it to ServeArgs to stop the goroutines
+// when the server shuts down.
+type Supervisor struct {
+	cancel context.CancelFunc
+	ctx    context.Context
+	logger *slog.Logger
+	mux    sync.Mutex
+	status map[string]*TaskStatus
+	wg     sync.WaitGroup
+}
+
+// NewSupervisor creates a Supervisor. Its goroutines are stopped when ctx is done or Stop is called.
+func NewSupervisor(ctx context.Context, logger *slog.Logger) *Supervisor {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Supervisor{
+		cancel: cancel,
+		ctx:    ctx,
+		logger: logger,
+		status: make(map[string]*TaskStatus),
+	}
+}
+
+// Go runs fn in a supervised goroutine. The context passed to fn is done when the Supervisor stops. Names should be
+// unique so the status of each goroutine can be told apart.
+func (s *Supervisor) Go(name string, fn func(ctx context.Context) error, options GoOptions) {
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = DefaultMaxBackoff
+	}
+	if options.MinBackoff == 0 {
+		options.MinBackoff = DefaultMinBackoff
+	}
+	status := &TaskStatus{
+		Name: name,
+	}
+	s.mux.Lock()
+	s.status[name] = status
+	s.mux.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		l := s.logger.With(constant.LogTask, name)
+		backoff := options.MinBackoff
+		for {
+			s.mux.Lock()
+			status.LastStart = time.Now()
+			status.Running = true
+			s.mux.Unlock()
+
+			err := runRecovered(s.ctx, fn)
+
+			s.mux.Lock()
+			status.Running = false
+			if err != nil {
+				status.LastError = err.Error()
+			}
+			ranFor := time.Since(status.LastStart)
+			s.mux.Unlock()
+
+			if s.ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				l.ErrorContext(s.ctx, "Supervised goroutine failed.",
+					constant.LogErr, err,
+				)
+			}
+			stop, gaveUp := false, false
+			switch {
+			case options.Restart == RestartNever,
+				options.Restart == RestartOnFailure && err == nil:
+				stop, gaveUp = true, err != nil
+			case options.MaxRestarts > 0 && status.Restarts >= options.MaxRestarts:
+				stop, gaveUp = true, true
+			}
+			if stop {
+				if gaveUp {
+					s.mux.Lock()
+					status.GaveUp = true
+					s.mux.Unlock()
+					l.ErrorContext(s.ctx, "Supervised goroutine won't be restarted.")
+				}
+				return
+			}
+
+			if ranFor > options.MaxBackoff {
+				backoff = options.MinBackoff
+			}
+			delay := backoff/2 + rand.N(backoff/2+1)
+			backoff = min(backoff*2, options.MaxBackoff)
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			s.mux.Lock()
+			status.Restarts++
+			s.mux.Unlock()
+			l.InfoContext(s.ctx, "Restarting supervised goroutine.")
+		}
+	}()
+}
+
+// Status returns the status of every supervised goroutine, sorted by name.
+func (s *Supervisor) Status() []TaskStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	statuses := make([]TaskStatus, 0, len(s.status))
+	for _, status := range s.status {
+		statuses = append(statuses, *status)
+	}
+	slices.SortFunc(statuses, func(a, b TaskStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return statuses
+}
+
+// HealthCheck returns a health.Check that fails if any supervised goroutine failed and won't be restarted, such as
+// after using up GoOptions.MaxRestarts. Add it to the health.Checker of the readiness endpoint.
+func (s *Supervisor) HealthCheck() health.Check {
+	return func(ctx context.Context) error {
+		var names []string
+		for _, status := range s.Status() {
+			if status.GaveUp {
+				names = append(names, status.Name)
+			}
+		}
+		if len(names) != 0 {
+			return fmt.Errorf("supervised goroutines failed and won't be restarted: %s", strings.Join(names, ", "))
+		}
+		return nil
+	}
+}
+
+// Stop cancels the goroutines' context and waits for them to return or for ctx to be done.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("supervised goroutines did not stop before context ended: %w", ctx.Err())
+	}
+}
+
+var errPanic = errors.New("panic")
+
+func runRecovered(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("%w: %v\n%s", errPanic, r, debug.Stack())
+		}
+	}()
+	return fn(ctx)
+}
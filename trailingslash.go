@@ -0,0 +1,269 @@
+package httphandle
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/MicahParks/httphandle/constant"
+)
+
+// TrailingSlashPolicy controls how Attach handles a request path that differs from a registered pattern only by a
+// trailing slash. Subtree patterns like "/static/" still match every path below them. The index pattern "/" and
+// patterns ending in a "..." wildcard or "{$}" are left alone.
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashDefault keeps the http.ServeMux behavior. "/foo" redirects to "/foo/" if only the subtree pattern
+	// "/foo/" is registered. "/foo/" is not found if only "/foo" is registered.
+	TrailingSlashDefault TrailingSlashPolicy = iota
+	// TrailingSlashRedirectRemove redirects "/foo/" to "/foo".
+	TrailingSlashRedirectRemove
+	// TrailingSlashRedirectAdd redirects "/foo" to "/foo/".
+	TrailingSlashRedirectAdd
+	// TrailingSlashStrict treats "/foo" and "/foo/" as distinct paths. A path is only served by a pattern that matches
+	// it as written, and the other form is sent to AttachArgs.NotFound or AppSpecific.NotFound.
+	TrailingSlashStrict
+)
+
+type registration struct {
+	handler http.Handler
+	pattern string
+}
+
+type splitPattern struct {
+	method string
+	host   string
+	path   string
+}
+
+func parsePattern(pattern string) splitPattern {
+	var p splitPattern
+	method, rest, found := strings.Cut(pattern, " ")
+	if found && !strings.Contains(method, "/") {
+		p.method = method
+		pattern = strings.TrimLeft(rest, " \t")
+	}
+	i := strings.Index(pattern, "/")
+	if i == -1 {
+		p.host = pattern
+		return p
+	}
+	p.host = pattern[:i]
+	p.path = pattern[i:]
+	return p
+}
+
+func (p splitPattern) key(path string) string {
+	return p.method + " " + p.host + path
+}
+
+func (p splitPattern) with(path string) string {
+	pattern := p.host + path
+	if p.method != "" {
+		pattern = p.method + " " + pattern
+	}
+	return pattern
+}
+
+// withHost returns the pattern restricted to the host. An empty host leaves the pattern unchanged.
+func withHost(host, pattern string) string {
+	if host == "" {
+		return pattern
+	}
+	p := parsePattern(pattern)
+	p.host = host
+	return p.with(p.path)
+}
+
+func applyTrailingSlash(policy TrailingSlashPolicy, registrations []registration, notFound http.Handler) []registration {
+	if policy == TrailingSlashDefault {
+		return registrations
+	}
+
+	registered := make(map[string]bool, len(registrations))
+	for _, reg := range registrations {
+		p := parsePattern(reg.pattern)
+		registered[p.key(p.path)] = true
+	}
+
+	result := make([]registration, 0, len(registrations))
+	for _, reg := range registrations {
+		p := parsePattern(reg.pattern)
+		if p.path == "" || p.path == "/" || strings.HasSuffix(p.path, "...}") || strings.HasSuffix(p.path, "{$}") {
+			result = append(result, reg)
+			continue
+		}
+
+		if !strings.HasSuffix(p.path, "/") {
+			// An exact pattern like "/foo".
+			slashed := p.path + "/"
+			if registered[p.key(slashed)] {
+				result = append(result, reg)
+				continue
+			}
+			switch policy {
+			case TrailingSlashRedirectRemove:
+				result = append(result, reg, registration{
+					handler: http.HandlerFunc(redirectRemoveSlash),
+					pattern: p.with(slashed + "{$}"),
+				})
+			case TrailingSlashRedirectAdd:
+				result = append(result, registration{
+					handler: http.HandlerFunc(redirectAddSlash),
+					pattern: reg.pattern,
+				}, registration{
+					handler: reg.handler,
+					pattern: p.with(slashed + "{$}"),
+				})
+			case TrailingSlashStrict:
+				result = append(result, reg, registration{
+					handler: notFound,
+					pattern: p.with(slashed + "{$}"),
+				})
+			default:
+				result = append(result, reg)
+			}
+			continue
+		}
+
+		// A subtree pattern like "/foo/".
+		trimmed := strings.TrimSuffix(p.path, "/")
+		if registered[p.key(trimmed)] {
+			result = append(result, reg)
+			continue
+		}
+		switch policy {
+		case TrailingSlashRedirectRemove:
+			result = append(result, reg, registration{
+				handler: reg.handler,
+				pattern: p.with(trimmed),
+			}, registration{
+				handler: http.HandlerFunc(redirectRemoveSlash),
+				pattern: p.with(p.path + "{$}"),
+			})
+		case TrailingSlashRedirectAdd:
+			// The mux would redirect on its own, but its redirect doesn't know about a prefix stripped by AttachPrefix.
+			result = append(result, reg, registration{
+				handler: http.HandlerFunc(redirectAddSlash),
+				pattern: p.with(trimmed),
+			})
+		case TrailingSlashStrict:
+			result = append(result, reg, registration{
+				handler: notFound,
+				pattern: p.with(trimmed),
+			})
+		default:
+			result = append(result, reg)
+		}
+	}
+	return result
+}
+
+// methodNotAllowedRegistrations creates a method-less fallback registration for every path that only has
+// method-specific registrations. The mux prefers the method-specific patterns, so the fallback only sees requests with
+// other methods.
+func methodNotAllowedRegistrations(registrations []registration, handler http.Handler) []registration {
+	methods := make(map[string][]string)
+	var order []string
+	hasFallback := make(map[string]bool)
+	for _, reg := range registrations {
+		p := parsePattern(reg.pattern)
+		method := p.method
+		p.method = ""
+		pattern := p.with(p.path)
+		if method == "" {
+			hasFallback[pattern] = true
+			continue
+		}
+		_, ok := methods[pattern]
+		if !ok {
+			order = append(order, pattern)
+		}
+		methods[pattern] = append(methods[pattern], method)
+		if method == http.MethodGet {
+			methods[pattern] = append(methods[pattern], http.MethodHead)
+		}
+	}
+
+	var result []registration
+	for _, pattern := range order {
+		if hasFallback[pattern] {
+			continue
+		}
+		allowed := methods[pattern]
+		slices.Sort(allowed)
+		allow := strings.Join(slices.Compact(allowed), ", ")
+		result = append(result, registration{
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(constant.HeaderAllow, allow)
+				handler.ServeHTTP(w, r)
+			}),
+			pattern: pattern,
+		})
+	}
+	return result
+}
+
+// register checks the registrations against an empty mux, then registers them on the router. Panics from the router are
+// returned as errors.
+func register(router Router, registrations []registration) error {
+	check := http.NewServeMux()
+	for _, reg := range registrations {
+		err := handle(check, reg)
+		if err != nil {
+			return err
+		}
+	}
+	for _, reg := range registrations {
+		err := handle(router, reg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handle(router Router, reg registration) (err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("failed to register pattern %q: %v", reg.pattern, r)
+		}
+	}()
+	router.Handle(reg.pattern, reg.handler)
+	return nil
+}
+
+func redirectAddSlash(w http.ResponseWriter, r *http.Request) {
+	u := OriginalURL(r)
+	u.Path += "/"
+	redirectURL(w, r, u)
+}
+
+func redirectRemoveSlash(w http.ResponseWriter, r *http.Request) {
+	u := OriginalURL(r)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	redirectURL(w, r, u)
+}
+
+// OriginalURL returns the request URL before any prefix was stripped by http.StripPrefix, such as by AttachPrefix. Use
+// it for redirects and cookie paths in handlers that may be attached under a prefix.
+func OriginalURL(r *http.Request) url.URL {
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil || r.RequestURI == "" {
+		return *r.URL
+	}
+	u.RawPath = ""
+	return *u
+}
+
+func redirectURL(w http.ResponseWriter, r *http.Request, u url.URL) {
+	code := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	http.Redirect(w, r, u.RequestURI(), code)
+}